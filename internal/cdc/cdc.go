@@ -0,0 +1,278 @@
+// Package cdc decodes JSON changefeed messages of YDB tables into typed events
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+)
+
+// Operation is a kind of row change
+type Operation string
+
+const (
+	OperationUpsert Operation = "upsert"
+	OperationErase  Operation = "erase"
+	// OperationResolved is a resolved timestamp message, it holds no row change
+	OperationResolved Operation = "resolved"
+)
+
+// Event is a decoded changefeed message. Row columns are mapped on fields of T.
+type Event[T any] struct {
+	Operation Operation
+	// Key holds primary key columns of changed row only
+	Key T
+	// NewImage is a row after change: the whole row in NEW_IMAGE and NEW_AND_OLD_IMAGES modes, key and
+	// updated columns in UPDATES mode, key only in KEYS_ONLY and OLD_IMAGE modes. It is nil for erase.
+	NewImage *T
+	// OldImage is a row before change in OLD_IMAGE and NEW_AND_OLD_IMAGES modes, it is nil in other modes
+	// and for insert of new row
+	OldImage *T
+	// Columns are names of non-key columns which are present in new image or update
+	Columns []string
+	// Timestamp is a virtual timestamp (plan step and transaction id) of change or resolved timestamp,
+	// it is set only if changefeed is created with VIRTUAL_TIMESTAMPS or RESOLVED_TIMESTAMPS
+	Timestamp []uint64
+}
+
+// Changed reports whether column is present in new image or update
+func (e *Event[T]) Changed(column string) bool {
+	for _, c := range e.Columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Row is a row with values of all table columns by column names, decoder of Row is used to copy rows
+// without mapping them on structs
+type Row map[string]types.Value
+
+var rowType = reflect.TypeOf(Row(nil))
+
+// message is a raw changefeed message in JSON format
+type message struct {
+	Key      []json.RawMessage          `json:"key"`
+	Update   map[string]json.RawMessage `json:"update"`
+	Erase    json.RawMessage            `json:"erase"`
+	NewImage map[string]json.RawMessage `json:"newImage"`
+	OldImage map[string]json.RawMessage `json:"oldImage"`
+	Ts       []uint64                   `json:"ts"`
+	Resolved []uint64                   `json:"resolved"`
+}
+
+// Decoder decodes changefeed messages of one table. Table columns are mapped on fields of struct T by
+// `cdc:"column"` tag or by case-insensitive field name, `cdc:"-"` skips field. Columns without fields and
+// untagged fields without columns are ignored. Decoder of Row holds all columns as YDB values.
+type Decoder[T any] struct {
+	key     []*column
+	columns map[string]*column
+	row     bool
+}
+
+// NewDecoder makes decoder for table with description, it checks that fields of T are compatible with
+// column types
+func NewDecoder[T any](description options.Description) (*Decoder[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct && t != rowType {
+		return nil, fmt.Errorf("cdc: %v is not a struct", t)
+	}
+	d := &Decoder[T]{
+		columns: make(map[string]*column, len(description.Columns)),
+		row:     t == rowType,
+	}
+	for _, c := range description.Columns {
+		d.columns[c.Name] = &column{
+			name: c.Name,
+			typ:  c.Type,
+			kind: kindOf(c.Type),
+		}
+		if _, _, ok := primitiveType(c.Type); d.row && !ok {
+			return nil, fmt.Errorf("cdc: column '%s' of type %s is not supported", c.Name, c.Type.Yql())
+		}
+	}
+	for i := 0; !d.row && i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, tagged, ok := fieldColumn(f)
+		if !ok {
+			continue
+		}
+		c := d.lookup(name)
+		if c == nil && !tagged {
+			continue
+		}
+		if c == nil {
+			return nil, fmt.Errorf("cdc: column '%s' of field %v.%s is not found in table '%s'",
+				name, t, f.Name, description.Name)
+		}
+		if !c.kind.compatible(f.Type) {
+			return nil, fmt.Errorf("cdc: field %v.%s of type %v is not compatible with column '%s'",
+				t, f.Name, f.Type, c.name)
+		}
+		c.field = f.Index
+	}
+	for _, name := range description.PrimaryKey {
+		c, ok := d.columns[name]
+		if !ok {
+			return nil, fmt.Errorf("cdc: primary key column '%s' is not found in table '%s'", name, description.Name)
+		}
+		d.key = append(d.key, c)
+	}
+	return d, nil
+}
+
+// DescribeDecoder makes decoder for table with tablePath using its description
+func DescribeDecoder[T any](ctx context.Context, c table.Client, tablePath string) (*Decoder[T], error) {
+	var description options.Description
+	err := c.Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			description, err = s.DescribeTable(ctx, tablePath)
+			return err
+		},
+		table.WithIdempotent(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cdc: describe table '%s' failed: %w", tablePath, err)
+	}
+	return NewDecoder[T](description)
+}
+
+// fieldColumn returns column name of struct field and whether it is set by tag, unexported and skipped
+// fields have no column
+func fieldColumn(f reflect.StructField) (name string, tagged bool, ok bool) {
+	if f.PkgPath != "" {
+		return "", false, false
+	}
+	switch tag := f.Tag.Get("cdc"); tag {
+	case "-":
+		return "", false, false
+	case "":
+		return f.Name, false, true
+	default:
+		return tag, true, true
+	}
+}
+
+// lookup finds column by exact name or, if there is no such column, by case-insensitive name
+func (d *Decoder[T]) lookup(name string) *column {
+	if c, ok := d.columns[name]; ok {
+		return c
+	}
+	for n, c := range d.columns {
+		if strings.EqualFold(n, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// DecodeMessage reads and decodes changefeed message
+func (d *Decoder[T]) DecodeMessage(msg *topicreader.Message) (Event[T], error) {
+	data, err := io.ReadAll(msg)
+	if err != nil {
+		return Event[T]{}, fmt.Errorf("cdc: read message failed: %w", err)
+	}
+	return d.Decode(data)
+}
+
+// Decode decodes changefeed message of any mode
+func (d *Decoder[T]) Decode(data []byte) (e Event[T], err error) {
+	var msg message
+	if err = json.Unmarshal(data, &msg); err != nil {
+		return e, fmt.Errorf("cdc: unmarshal message failed: %w", err)
+	}
+
+	if msg.Resolved != nil {
+		e.Operation, e.Timestamp = OperationResolved, msg.Resolved
+		return e, nil
+	}
+	e.Timestamp = msg.Ts
+
+	if len(msg.Key) != len(d.key) {
+		return e, fmt.Errorf("cdc: message has %d key columns, table has %d", len(msg.Key), len(d.key))
+	}
+	e.Key = d.newRow()
+	if err = d.setKey(&e.Key, msg.Key); err != nil {
+		return e, err
+	}
+
+	// update of row is sent in all modes, but it holds changed columns only in UPDATES mode, modes with
+	// images send empty update and columns in images
+	newImage := msg.NewImage
+	if newImage == nil {
+		newImage = msg.Update
+	}
+	switch {
+	case msg.Erase != nil || newImage == nil:
+		e.Operation = OperationErase
+	default:
+		e.Operation = OperationUpsert
+		e.NewImage = d.copyRow(e.Key)
+		if e.Columns, err = d.setColumns(e.NewImage, newImage); err != nil {
+			return e, err
+		}
+	}
+	if msg.OldImage != nil {
+		e.OldImage = d.copyRow(e.Key)
+		if _, err = d.setColumns(e.OldImage, msg.OldImage); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+func (d *Decoder[T]) newRow() (row T) {
+	if d.row {
+		return any(make(Row, len(d.columns))).(T)
+	}
+	return row
+}
+
+func (d *Decoder[T]) copyRow(src T) *T {
+	if !d.row {
+		return &src
+	}
+	row := make(Row, len(d.columns))
+	for k, v := range any(src).(Row) {
+		row[k] = v
+	}
+	dst := any(row).(T)
+	return &dst
+}
+
+func (d *Decoder[T]) setKey(row *T, key []json.RawMessage) error {
+	v := reflect.ValueOf(row).Elem()
+	for i, c := range d.key {
+		if err := c.set(v, key[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder[T]) setColumns(row *T, values map[string]json.RawMessage) (names []string, err error) {
+	v := reflect.ValueOf(row).Elem()
+	for name, raw := range values {
+		names = append(names, name)
+		c, ok := d.columns[name]
+		if !ok {
+			// column is added after decoder creation
+			continue
+		}
+		if err = c.set(v, raw); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
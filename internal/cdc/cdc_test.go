@@ -0,0 +1,220 @@
+package cdc
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+type item struct {
+	ID     uint64 `cdc:"id"`
+	Title  *string
+	Volume *int64
+}
+
+var itemsTable = options.Description{
+	Name: "items",
+	Columns: []options.Column{
+		{Name: "id", Type: types.TypeUint64},
+		{Name: "title", Type: types.Optional(types.TypeText)},
+		{Name: "volume", Type: types.Optional(types.TypeInt64)},
+	},
+	PrimaryKey: []string{"id"},
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestDecodeModes(t *testing.T) {
+	d, err := NewDecoder[item](itemsTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name     string
+		data     string
+		expected Event[item]
+	}{
+		{
+			name: "KEYS_ONLY",
+			data: `{"update":{},"key":[1]}`,
+			expected: Event[item]{
+				Operation: OperationUpsert,
+				Key:       item{ID: 1},
+				NewImage:  &item{ID: 1},
+			},
+		},
+		{
+			name: "KEYS_ONLY erase",
+			data: `{"erase":{},"key":[1]}`,
+			expected: Event[item]{
+				Operation: OperationErase,
+				Key:       item{ID: 1},
+			},
+		},
+		{
+			name: "UPDATES",
+			data: `{"update":{"volume":5},"key":[1],"ts":[10,20]}`,
+			expected: Event[item]{
+				Operation: OperationUpsert,
+				Key:       item{ID: 1},
+				NewImage:  &item{ID: 1, Volume: ptr[int64](5)},
+				Columns:   []string{"volume"},
+				Timestamp: []uint64{10, 20},
+			},
+		},
+		{
+			name: "NEW_IMAGE",
+			data: `{"update":{},"newImage":{"volume":5},"key":[1]}`,
+			expected: Event[item]{
+				Operation: OperationUpsert,
+				Key:       item{ID: 1},
+				NewImage:  &item{ID: 1, Volume: ptr[int64](5)},
+				Columns:   []string{"volume"},
+			},
+		},
+		{
+			name: "OLD_IMAGE",
+			data: `{"update":{},"oldImage":{"title":"a","volume":4},"key":[1]}`,
+			expected: Event[item]{
+				Operation: OperationUpsert,
+				Key:       item{ID: 1},
+				NewImage:  &item{ID: 1},
+				OldImage:  &item{ID: 1, Title: ptr("a"), Volume: ptr[int64](4)},
+			},
+		},
+		{
+			name: "NEW_AND_OLD_IMAGES",
+			data: `{"update":{},"newImage":{"title":"a","volume":5},"oldImage":{"title":"a","volume":4},"key":[1]}`,
+			expected: Event[item]{
+				Operation: OperationUpsert,
+				Key:       item{ID: 1},
+				NewImage:  &item{ID: 1, Title: ptr("a"), Volume: ptr[int64](5)},
+				OldImage:  &item{ID: 1, Title: ptr("a"), Volume: ptr[int64](4)},
+				Columns:   []string{"title", "volume"},
+			},
+		},
+		{
+			name: "NEW_AND_OLD_IMAGES erase",
+			data: `{"erase":{},"oldImage":{"title":"a","volume":4},"key":[1]}`,
+			expected: Event[item]{
+				Operation: OperationErase,
+				Key:       item{ID: 1},
+				OldImage:  &item{ID: 1, Title: ptr("a"), Volume: ptr[int64](4)},
+			},
+		},
+		{
+			name: "resolved",
+			data: `{"resolved":[10,20]}`,
+			expected: Event[item]{
+				Operation: OperationResolved,
+				Timestamp: []uint64{10, 20},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := d.Decode([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(e, tt.expected) {
+				t.Fatalf("unexpected event: %+v, want %+v", e, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeRow(t *testing.T) {
+	d, err := NewDecoder[Row](options.Description{
+		Name: "payments",
+		Columns: []options.Column{
+			{Name: "id", Type: types.TypeUUID},
+			{Name: "amount", Type: types.Optional(types.DecimalType(22, 9))},
+			{Name: "comment", Type: types.Optional(types.TypeText)},
+		},
+		PrimaryKey: []string{"id"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := d.Decode([]byte(
+		`{"update":{},"newImage":{"amount":"-12.5","comment":null},"key":["f2f4a8e0-4a35-4b5e-9a4c-2b7f3a1d9c11"]}`,
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.NewImage == nil {
+		t.Fatal("new image is nil")
+	}
+	expected := map[string]types.Value{
+		"id": types.UUIDValue([16]byte{
+			0xf2, 0xf4, 0xa8, 0xe0, 0x4a, 0x35, 0x4b, 0x5e, 0x9a, 0x4c, 0x2b, 0x7f, 0x3a, 0x1d, 0x9c, 0x11,
+		}),
+		"amount":  types.OptionalValue(types.DecimalValueFromBigInt(big.NewInt(-12500000000), 22, 9)),
+		"comment": types.NullValue(types.TypeText),
+	}
+	for name, v := range expected {
+		actual, ok := (*e.NewImage)[name]
+		if !ok {
+			t.Fatalf("column '%s' is missing", name)
+		}
+		if actual.Yql() != v.Yql() {
+			t.Fatalf("column '%s' is %s, want %s", name, actual.Yql(), v.Yql())
+		}
+	}
+
+	if _, err = d.Decode([]byte(`{"update":{},"key":[null]}`)); err == nil {
+		t.Fatal("null value of not null key is decoded")
+	}
+}
+
+func TestNewDecoderUnsupportedRowColumn(t *testing.T) {
+	_, err := NewDecoder[Row](options.Description{
+		Name: "lists",
+		Columns: []options.Column{
+			{Name: "id", Type: types.TypeUint64},
+			{Name: "tags", Type: types.List(types.TypeText)},
+		},
+		PrimaryKey: []string{"id"},
+	})
+	if err == nil {
+		t.Fatal("decoder of list column is created")
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	for _, tt := range []struct {
+		s        string
+		expected string
+		err      bool
+	}{
+		{s: "1", expected: "100"},
+		{s: "-1.5", expected: "-150"},
+		{s: "0.01", expected: "1"},
+		{s: "999.99", expected: "99999"},
+		{s: "1000", err: true},
+		{s: "0.001", err: true},
+		{s: "abc", err: true},
+		{s: "", err: true},
+	} {
+		t.Run(tt.s, func(t *testing.T) {
+			v, err := parseDecimal(tt.s, 5, 2)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("decimal is parsed: %v", v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.String() != tt.expected {
+				t.Fatalf("unexpected value: %v, want %s", v, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package cdc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+// kind is a class of column types with the same JSON representation in changefeed
+type kind int
+
+const (
+	// kindRaw is a column of container or unknown type, it is kept as raw JSON
+	kindRaw kind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	// kindText is a column represented by JSON string: Utf8, Json, Uuid, Decimal etc.
+	kindText
+	// kindBytes is a String or Yson column represented by base64 encoded JSON string
+	kindBytes
+	// kindTime is a Date, Datetime or Timestamp column represented by ISO 8601 JSON string
+	kindTime
+	// kindInterval is an Interval column represented by count of microseconds
+	kindInterval
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	rawType      = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// kindOf returns kind of column type
+func kindOf(t types.Type) kind {
+	name := t.Yql()
+	for strings.HasPrefix(name, "Optional<") {
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "Optional<"), ">")
+	}
+	switch {
+	case name == "Bool":
+		return kindBool
+	case name == "Int8", name == "Int16", name == "Int32", name == "Int64":
+		return kindInt
+	case name == "Uint8", name == "Uint16", name == "Uint32", name == "Uint64":
+		return kindUint
+	case name == "Float", name == "Double":
+		return kindFloat
+	case name == "Utf8", name == "Json", name == "JsonDocument", name == "Uuid", name == "DyNumber",
+		name == "TzDate", name == "TzDatetime", name == "TzTimestamp", strings.HasPrefix(name, "Decimal"):
+		return kindText
+	case name == "String", name == "Yson":
+		return kindBytes
+	case name == "Date", name == "Datetime", name == "Timestamp":
+		return kindTime
+	case name == "Interval":
+		return kindInterval
+	default:
+		return kindRaw
+	}
+}
+
+// compatible reports whether value of kind may be stored in field of type t, pointer fields hold nullable values
+func (k kind) compatible(t reflect.Type) bool {
+	if t == rawType {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch k {
+	case kindBool:
+		return t.Kind() == reflect.Bool
+	case kindInt, kindUint:
+		return t != durationType && (isInt(t) || isUint(t))
+	case kindFloat:
+		return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+	case kindText, kindBytes:
+		return t.Kind() == reflect.String || t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8
+	case kindTime:
+		return t == timeType
+	case kindInterval:
+		return t == durationType
+	default:
+		return false
+	}
+}
+
+func isInt(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+func isUint(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// column is a table column and its field in row struct
+type column struct {
+	name string
+	typ  types.Type
+	kind kind
+	// field is an index of struct field, nil if column is not mapped
+	field []int
+}
+
+// set stores JSON value of column in field of row
+func (c *column) set(row reflect.Value, raw json.RawMessage) (err error) {
+	switch {
+	case row.Kind() == reflect.Map:
+		var v types.Value
+		if v, err = c.value(raw); err == nil {
+			row.SetMapIndex(reflect.ValueOf(c.name), reflect.ValueOf(&v).Elem())
+		}
+	case c.field != nil:
+		err = c.decode(row.FieldByIndex(c.field), raw)
+	}
+	if err != nil {
+		return fmt.Errorf("cdc: decode column '%s' value %s failed: %w", c.name, raw, err)
+	}
+	return nil
+}
+
+// value converts JSON value of column to YDB value of column type
+func (c *column) value(raw json.RawMessage) (types.Value, error) {
+	t, optional, ok := primitiveType(c.typ)
+	if !ok {
+		return nil, fmt.Errorf("unsupported column type %s", c.typ.Yql())
+	}
+	if bytes.Equal(raw, []byte("null")) {
+		if !optional {
+			return nil, fmt.Errorf("null value of not null column")
+		}
+		return types.NullValue(t), nil
+	}
+	v, err := c.primitiveValue(t, raw)
+	if err != nil {
+		return nil, err
+	}
+	if optional {
+		return types.OptionalValue(v), nil
+	}
+	return v, nil
+}
+
+func (c *column) decode(v reflect.Value, raw json.RawMessage) error {
+	if v.Type() == rawType {
+		v.SetBytes(append(json.RawMessage(nil), raw...))
+		return nil
+	}
+	if bytes.Equal(raw, []byte("null")) {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := c.decode(p.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	switch c.kind {
+	case kindBool:
+		var b bool
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case kindInt, kindUint, kindInterval:
+		return decodeInteger(v, raw)
+	case kindFloat:
+		var f float64
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case kindText, kindBytes:
+		var s string
+		switch {
+		case c.kind == kindText && len(raw) > 0 && raw[0] != '"':
+			// Json columns may be represented by JSON values of any type
+			s = string(raw)
+		default:
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return err
+			}
+		}
+		if c.kind == kindBytes {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return err
+			}
+			s = string(b)
+		}
+		if v.Kind() == reflect.String {
+			v.SetString(s)
+		} else {
+			v.SetBytes([]byte(s))
+		}
+	case kindTime:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	default:
+		return fmt.Errorf("unsupported column type")
+	}
+	return nil
+}
+
+// decodeInteger stores JSON number in integer field, interval is a count of microseconds
+func decodeInteger(v reflect.Value, raw json.RawMessage) error {
+	s := string(raw)
+	switch {
+	case v.Type() == durationType:
+		us, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(time.Duration(us) * time.Microsecond))
+	case isInt(v.Type()):
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("value overflows %v", v.Type())
+		}
+		v.SetInt(i)
+	default:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("value overflows %v", v.Type())
+		}
+		v.SetUint(u)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package cdc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+// primitiveTypes are column types which are supported in Row by their names
+var primitiveTypes = map[string]types.Type{
+	"Bool":         types.TypeBool,
+	"Int8":         types.TypeInt8,
+	"Int16":        types.TypeInt16,
+	"Int32":        types.TypeInt32,
+	"Int64":        types.TypeInt64,
+	"Uint8":        types.TypeUint8,
+	"Uint16":       types.TypeUint16,
+	"Uint32":       types.TypeUint32,
+	"Uint64":       types.TypeUint64,
+	"Float":        types.TypeFloat,
+	"Double":       types.TypeDouble,
+	"Utf8":         types.TypeText,
+	"String":       types.TypeBytes,
+	"Json":         types.TypeJSON,
+	"JsonDocument": types.TypeJSONDocument,
+	"Yson":         types.TypeYSON,
+	"DyNumber":     types.TypeDyNumber,
+	"Date":         types.TypeDate,
+	"Datetime":     types.TypeDatetime,
+	"Timestamp":    types.TypeTimestamp,
+	"Interval":     types.TypeInterval,
+	"TzDate":       types.TypeTzDate,
+	"TzDatetime":   types.TypeTzDatetime,
+	"TzTimestamp":  types.TypeTzTimestamp,
+	"Uuid":         types.TypeUUID,
+}
+
+// primitiveType returns type of Row values of column type t, optional types are unwrapped. Decimal types are
+// parameterized by precision and scale, so they are parsed from type name.
+func primitiveType(t types.Type) (primitive types.Type, optional bool, ok bool) {
+	name := t.Yql()
+	optional = strings.HasPrefix(name, "Optional<")
+	if optional {
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "Optional<"), ">")
+	}
+	if primitive, ok = primitiveTypes[name]; ok {
+		return primitive, optional, true
+	}
+	var precision, scale uint32
+	if _, err := fmt.Sscanf(name, "Decimal(%d,%d)", &precision, &scale); err == nil {
+		return types.DecimalType(precision, scale), optional, true
+	}
+	return nil, false, false
+}
+
+// parseDecimal parses decimal number to integer value scaled by 10^scale
+func parseDecimal(s string, precision, scale uint32) (*big.Int, error) {
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if uint32(len(fraction)) > scale {
+		return nil, fmt.Errorf("decimal %s has more than %d fractional digits", s, scale)
+	}
+	digits = whole + fraction + strings.Repeat("0", int(scale)-len(fraction))
+	v, ok := new(big.Int).SetString(digits, 10)
+	if !ok || whole == "" && fraction == "" {
+		return nil, fmt.Errorf("bad decimal %s", s)
+	}
+	if v.Cmp(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(precision)), nil)) >= 0 {
+		return nil, fmt.Errorf("decimal %s exceeds precision %d", s, precision)
+	}
+	if strings.HasPrefix(s, "-") {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+// primitiveValue converts not null JSON value to YDB value of primitive type t
+func (c *column) primitiveValue(t types.Type, raw json.RawMessage) (types.Value, error) {
+	switch t {
+	case types.TypeBool:
+		var v bool
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.BoolValue(v), err
+	case types.TypeInt8:
+		var v int8
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Int8Value(v), err
+	case types.TypeInt16:
+		var v int16
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Int16Value(v), err
+	case types.TypeInt32:
+		var v int32
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Int32Value(v), err
+	case types.TypeInt64:
+		var v int64
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Int64Value(v), err
+	case types.TypeUint8:
+		var v uint8
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Uint8Value(v), err
+	case types.TypeUint16:
+		var v uint16
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Uint16Value(v), err
+	case types.TypeUint32:
+		var v uint32
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Uint32Value(v), err
+	case types.TypeUint64:
+		var v uint64
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.Uint64Value(v), err
+	case types.TypeFloat:
+		var v float32
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.FloatValue(v), err
+	case types.TypeDouble:
+		var v float64
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.DoubleValue(v), err
+	case types.TypeBytes, types.TypeYSON:
+		var v []byte
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		if t == types.TypeYSON {
+			return types.YSONValueFromBytes(v), err
+		}
+		return types.BytesValue(v), err
+	case types.TypeDate, types.TypeDatetime, types.TypeTimestamp:
+		var v time.Time
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		switch t {
+		case types.TypeDate:
+			return types.DateValueFromTime(v), err
+		case types.TypeDatetime:
+			return types.DatetimeValueFromTime(v), err
+		default:
+			return types.TimestampValueFromTime(v), err
+		}
+	case types.TypeInterval:
+		var v time.Duration
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		return types.IntervalValueFromDuration(v), err
+	default:
+		var v string
+		err := c.decode(reflect.ValueOf(&v).Elem(), raw)
+		switch t {
+		case types.TypeJSON:
+			return types.JSONValue(v), err
+		case types.TypeJSONDocument:
+			return types.JSONDocumentValue(v), err
+		case types.TypeDyNumber:
+			return types.DyNumberValue(v), err
+		case types.TypeTzDate:
+			return types.TzDateValue(v), err
+		case types.TypeTzDatetime:
+			return types.TzDatetimeValue(v), err
+		case types.TypeTzTimestamp:
+			return types.TzTimestampValue(v), err
+		case types.TypeUUID:
+			if err != nil {
+				return nil, err
+			}
+			u, err := uuid.Parse(v)
+			return types.UUIDValue(u), err
+		}
+		var precision, scale uint32
+		if _, scanErr := fmt.Sscanf(t.Yql(), "Decimal(%d,%d)", &precision, &scale); scanErr != nil {
+			return types.TextValue(v), err
+		}
+		if err != nil {
+			return nil, err
+		}
+		d, err := parseDecimal(v, precision, scale)
+		if err != nil {
+			return nil, err
+		}
+		return types.DecimalValueFromBigInt(d, precision, scale), nil
+	}
+}
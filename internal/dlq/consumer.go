@@ -0,0 +1,194 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+)
+
+// RetryPolicy is a policy of message processing retries
+type RetryPolicy struct {
+	// MaxAttempts is a count of processing attempts after which message is published to dead-letter topic
+	MaxAttempts int
+	// Backoff is a delay before the second attempt, it is doubled for every next attempt
+	Backoff time.Duration
+	// MaxBackoff limits delay between attempts
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy makes three attempts with delays of 100ms and 200ms
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// delay returns delay before the next attempt after attempt
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks error of message processing which can't be fixed by retries, e.g. malformed content,
+// message is published to dead-letter topic without retries
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Handler processes message with content data, ctx is canceled when partition of message is revoked
+type Handler func(ctx context.Context, msg *topicreader.Message, data []byte) error
+
+// batchReader reads and commits batches of messages, it is implemented by *topicreader.Reader
+type batchReader interface {
+	ReadMessageBatch(ctx context.Context, opts ...topicreader.ReadBatchOption) (*topicreader.Batch, error)
+	Commit(ctx context.Context, obj topicreader.CommitRangeGetter) error
+}
+
+// letterPublisher publishes letters to dead-letter topic, it is implemented by *Publisher
+type letterPublisher interface {
+	Publish(ctx context.Context, letters ...Letter) error
+}
+
+// Processor processes messages with handler. Failed messages are retried by policy and then published to
+// dead-letter topic. It is used by readers which read and commit messages themselves.
+type Processor struct {
+	publisher letterPublisher
+	policy    RetryPolicy
+	handler   Handler
+}
+
+func NewProcessor(publisher *Publisher, policy RetryPolicy, handler Handler) *Processor {
+	return newProcessor(publisher, policy, handler)
+}
+
+func newProcessor(publisher letterPublisher, policy RetryPolicy, handler Handler) *Processor {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	return &Processor{
+		publisher: publisher,
+		policy:    policy,
+		handler:   handler,
+	}
+}
+
+// Process handles message with retries, and publishes it to dead-letter topic if all attempts are failed.
+// Message may be committed if error is nil.
+func (p *Processor) Process(ctx context.Context, msg *topicreader.Message) error {
+	data, err := io.ReadAll(msg)
+	letter := func(err error, attempts int) Letter {
+		log.Printf("dlq: message %d of partition %d of %s failed after %d attempts: %v",
+			msg.Offset, msg.PartitionID(), msg.Topic(), attempts, err,
+		)
+		return NewLetter(msg, data, err, attempts)
+	}
+	if err != nil {
+		// content which can't be decompressed is never processed
+		return p.publisher.Publish(ctx, letter(Permanent(fmt.Errorf("read content failed: %w", err)), 0))
+	}
+	return p.process(ctx, func(ctx context.Context) error {
+		return p.handler(ctx, msg, data)
+	}, letter)
+}
+
+// process calls handle with retries, and publishes letter if all attempts are failed
+func (p *Processor) process(
+	ctx context.Context, handle func(ctx context.Context) error, letter func(err error, attempts int) Letter,
+) error {
+	for attempt := 1; ; attempt++ {
+		err := handle(ctx)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isPermanent(err) || attempt >= p.policy.MaxAttempts {
+			return p.publisher.Publish(ctx, letter(err, attempt))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.policy.delay(attempt)):
+		}
+	}
+}
+
+// Consumer reads messages from topic and processes them with handler. Failed messages are retried by policy
+// and then published to dead-letter topic, so one poison message doesn't stop reading.
+type Consumer struct {
+	reader    batchReader
+	processor *Processor
+}
+
+func NewConsumer(reader *topicreader.Reader, publisher *Publisher, policy RetryPolicy, handler Handler) *Consumer {
+	return &Consumer{
+		reader:    reader,
+		processor: NewProcessor(publisher, policy, handler),
+	}
+}
+
+// Run processes messages until ctx is done or error of reading, publishing or commit. Batch is committed after
+// all its messages are processed or published to dead-letter topic.
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		batch, err := c.reader.ReadMessageBatch(ctx)
+		if err != nil {
+			return fmt.Errorf("dlq: read failed: %w", err)
+		}
+		batchCtx, cancel := batchContext(ctx, batch)
+		for _, msg := range batch.Messages {
+			if err = c.processor.Process(batchCtx, msg); err != nil {
+				break
+			}
+		}
+		cancel()
+		if err != nil && ctx.Err() == nil && batch.Context().Err() != nil {
+			// partition is revoked, not committed messages are read again by its next reader
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = c.reader.Commit(ctx, batch); err != nil {
+			return fmt.Errorf("dlq: commit failed: %w", err)
+		}
+	}
+}
+
+// batchContext returns context which is done when ctx is done or partition of batch is revoked
+func batchContext(ctx context.Context, batch *topicreader.Batch) (context.Context, context.CancelFunc) {
+	batchCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-batch.Context().Done():
+			cancel()
+		case <-batchCtx.Done():
+		}
+	}()
+	return batchCtx, cancel
+}
@@ -0,0 +1,146 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakePublisher collects published letters, it fails publishing with err
+type fakePublisher struct {
+	letters []Letter
+	err     error
+}
+
+func (p *fakePublisher) Publish(_ context.Context, letters ...Letter) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.letters = append(p.letters, letters...)
+	return nil
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for _, tt := range []struct {
+		attempt  int
+		expected time.Duration
+	}{
+		{attempt: 1, expected: 100 * time.Millisecond},
+		{attempt: 2, expected: 200 * time.Millisecond},
+		{attempt: 3, expected: 400 * time.Millisecond},
+		{attempt: 4, expected: 800 * time.Millisecond},
+		{attempt: 5, expected: time.Second},
+		{attempt: 9, expected: time.Second},
+	} {
+		if d := p.delay(tt.attempt); d != tt.expected {
+			t.Fatalf("delay after attempt %d is %v, want %v", tt.attempt, d, tt.expected)
+		}
+	}
+	p.MaxBackoff = 0
+	if d := p.delay(5); d != 1600*time.Millisecond {
+		t.Fatalf("unlimited delay after attempt 5 is %v", d)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	cause := errors.New("malformed json")
+	err := fmt.Errorf("decode failed: %w", Permanent(cause))
+	if !isPermanent(err) {
+		t.Fatal("wrapped permanent error is not permanent")
+	}
+	if !errors.Is(err, cause) {
+		t.Fatal("permanent error doesn't wrap its cause")
+	}
+	if err.Error() != "decode failed: malformed json" {
+		t.Fatalf("unexpected message: %s", err)
+	}
+	if isPermanent(cause) {
+		t.Fatal("plain error is permanent")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+	for _, tt := range []struct {
+		name     string
+		failures int
+		err      error
+		attempts int
+		letter   bool
+	}{
+		{name: "processed", attempts: 1},
+		{name: "processed after retries", failures: 2, err: errors.New("unavailable"), attempts: 3},
+		{name: "dead-lettered after retries", failures: 5, err: errors.New("unavailable"), attempts: 3, letter: true},
+		{name: "dead-lettered permanent", failures: 5, err: Permanent(errors.New("malformed")), attempts: 1, letter: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &fakePublisher{}
+			p := newProcessor(publisher, policy, nil)
+			attempts := 0
+			err := p.process(context.Background(),
+				func(ctx context.Context) error {
+					attempts++
+					if attempts <= tt.failures {
+						return tt.err
+					}
+					return nil
+				},
+				func(err error, attempts int) Letter {
+					return Letter{Error: err.Error(), Attempts: attempts}
+				},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attempts != tt.attempts {
+				t.Fatalf("handled %d times, want %d", attempts, tt.attempts)
+			}
+			if !tt.letter {
+				if len(publisher.letters) != 0 {
+					t.Fatalf("processed message is dead-lettered: %+v", publisher.letters)
+				}
+				return
+			}
+			if len(publisher.letters) != 1 {
+				t.Fatalf("published %d letters, want 1", len(publisher.letters))
+			}
+			if l := publisher.letters[0]; l.Attempts != tt.attempts || l.Error != tt.err.Error() {
+				t.Fatalf("unexpected letter: %+v", l)
+			}
+		})
+	}
+}
+
+func TestProcessPublishFailed(t *testing.T) {
+	publishErr := errors.New("dead-letter topic is unavailable")
+	p := newProcessor(&fakePublisher{err: publishErr}, RetryPolicy{}, nil)
+	err := p.process(context.Background(),
+		func(ctx context.Context) error { return errors.New("unavailable") },
+		func(err error, attempts int) Letter { return Letter{} },
+	)
+	if !errors.Is(err, publishErr) {
+		t.Fatalf("message is committed after failed publish: %v", err)
+	}
+}
+
+func TestProcessCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	publisher := &fakePublisher{}
+	p := newProcessor(publisher, RetryPolicy{MaxAttempts: 3, Backoff: time.Hour}, nil)
+	err := p.process(ctx,
+		func(ctx context.Context) error {
+			cancel()
+			return errors.New("unavailable")
+		},
+		func(err error, attempts int) Letter { return Letter{} },
+	)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(publisher.letters) != 0 {
+		t.Fatal("message is dead-lettered after cancel")
+	}
+}
@@ -0,0 +1,97 @@
+// Package dlq handles poison messages of topic consumers: messages which are failed to process are published
+// to dead-letter topic with error metadata, so they don't stop reading of the main topic
+package dlq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicwriter"
+)
+
+// Letter is a message which is failed to process with its origin and error, it is published to dead-letter
+// topic as JSON object
+type Letter struct {
+	Topic          string    `json:"topic"`
+	Partition      int64     `json:"partition"`
+	Offset         int64     `json:"offset"`
+	SeqNo          int64     `json:"seq_no"`
+	MessageGroupID string    `json:"message_group_id"`
+	ProducerID     string    `json:"producer_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	WrittenAt      time.Time `json:"written_at"`
+	Error          string    `json:"error"`
+	Attempts       int       `json:"attempts"`
+	FailedAt       time.Time `json:"failed_at"`
+	// Data is an original content of message
+	Data []byte `json:"data"`
+}
+
+// NewLetter makes letter of message msg with content data which is failed with err after attempts
+func NewLetter(msg *topicreader.Message, data []byte, err error, attempts int) Letter {
+	return Letter{
+		Topic:          msg.Topic(),
+		Partition:      msg.PartitionID(),
+		Offset:         msg.Offset,
+		SeqNo:          msg.SeqNo,
+		MessageGroupID: msg.MessageGroupID,
+		ProducerID:     msg.ProducerID,
+		CreatedAt:      msg.CreatedAt,
+		WrittenAt:      msg.WrittenAt,
+		Error:          err.Error(),
+		Attempts:       attempts,
+		FailedAt:       time.Now(),
+		Data:           data,
+	}
+}
+
+// Decode decodes letter from content of dead-letter topic message
+func Decode(data []byte) (letter Letter, err error) {
+	if err = json.Unmarshal(data, &letter); err != nil {
+		return letter, fmt.Errorf("dlq: decode letter failed: %w", err)
+	}
+	return letter, nil
+}
+
+// Publisher writes letters to dead-letter topic
+type Publisher struct {
+	writer *topicwriter.Writer
+}
+
+// NewPublisher starts writer to dead-letter topic. Write waits acknowledgement of server, so message may be
+// committed in the main topic right after its letter is published.
+func NewPublisher(db ydb.Connection, topicPath, producerID string) (*Publisher, error) {
+	writer, err := db.Topic().StartWriter(producerID, topicPath,
+		topicoptions.WithMessageGroupID(producerID),
+		topicoptions.WithSyncWrite(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("dlq: start writer to '%s' failed: %w", topicPath, err)
+	}
+	return &Publisher{writer: writer}, nil
+}
+
+func (p *Publisher) Publish(ctx context.Context, letters ...Letter) error {
+	messages := make([]topicwriter.Message, len(letters))
+	for i := range letters {
+		data, err := json.Marshal(&letters[i])
+		if err != nil {
+			return fmt.Errorf("dlq: encode letter failed: %w", err)
+		}
+		messages[i] = topicwriter.Message{Data: bytes.NewReader(data)}
+	}
+	if err := p.writer.Write(ctx, messages...); err != nil {
+		return fmt.Errorf("dlq: publish failed: %w", err)
+	}
+	return nil
+}
+
+func (p *Publisher) Close(ctx context.Context) error {
+	return p.writer.Close(ctx)
+}
@@ -0,0 +1,138 @@
+// Package httpmetrics provides prometheus instrumentation of http handlers routed with gorilla/mux
+package httpmetrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// unknownRoute is a route label of requests which are served without matched mux route
+const unknownRoute = "unknown"
+
+// Metrics is a set of http server metrics labeled by request method and route template
+type Metrics struct {
+	calls    *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// New creates http server metrics with namespace and registers them in registerer
+func New(registerer prometheus.Registerer, namespace string) *Metrics {
+	m := &Metrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "calls_total",
+			Help:      "Count of handled http requests by response status code",
+		}, []string{
+			"method",
+			"route",
+			"code",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Count of http requests answered with 4xx or 5xx status code",
+		}, []string{
+			"method",
+			"route",
+		}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "latency",
+			Help:      "Latency of http requests in seconds",
+			Buckets: []float64{
+				(1 * time.Millisecond).Seconds(),
+				(5 * time.Millisecond).Seconds(),
+				(10 * time.Millisecond).Seconds(),
+				(50 * time.Millisecond).Seconds(),
+				(100 * time.Millisecond).Seconds(),
+				(500 * time.Millisecond).Seconds(),
+				(1000 * time.Millisecond).Seconds(),
+				(5000 * time.Millisecond).Seconds(),
+				(10000 * time.Millisecond).Seconds(),
+			},
+		}, []string{
+			"method",
+			"route",
+			"success",
+		}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "in_flight",
+			Help:      "Count of http requests which are being handled now",
+		}, []string{
+			"method",
+			"route",
+		}),
+	}
+	registerer.MustRegister(m.calls, m.errors, m.latency, m.inFlight)
+	return m
+}
+
+// statusRecorder remembers status code written to response
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Middleware instruments next handler. It is intended to be used with mux.Router.Use,
+// so route label is a template of matched route, not a request path.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := unknownRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		labels := prometheus.Labels{
+			"method": r.Method,
+			"route":  route,
+		}
+
+		inFlight := m.inFlight.With(labels)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.code == 0 {
+			recorder.code = http.StatusOK
+		}
+
+		success := recorder.code < http.StatusBadRequest
+		if !success {
+			m.errors.With(labels).Inc()
+		}
+		m.latency.With(prometheus.Labels{
+			"method":  r.Method,
+			"route":   route,
+			"success": strconv.FormatBool(success),
+		}).Observe(time.Since(start).Seconds())
+		m.calls.With(prometheus.Labels{
+			"method": r.Method,
+			"route":  route,
+			"code":   strconv.Itoa(recorder.code),
+		}).Inc()
+	})
+}
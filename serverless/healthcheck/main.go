@@ -5,18 +5,33 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"strconv"
+	"os/signal"
+	"syscall"
 	"time"
 
 	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
 )
 
 var (
-	dsn      string
-	prefix   string
-	count    int
-	interval time.Duration
-	urls     = URLs{}
+	dsn        string
+	prefix     string
+	count      int
+	interval   time.Duration
+	urls       = URLs{}
+	probesFile string
+
+	retries       int
+	retryBackoff  time.Duration
+	flapThreshold int
+	notifyStdout  bool
+	webhooks      = URLs{}
+
+	concurrency   int
+	jitter        float64
+	batchSize     int
+	flushInterval time.Duration
+
+	command string
 )
 
 // URLs is a flag.Value implementation which holds URL's as string slice
@@ -35,12 +50,19 @@ func (u *URLs) Set(s string) error {
 	return nil
 }
 
-func init() {
-	required := []string{"ydb", "url"}
+// parseFlags parses command line options, it is not called in tests
+func parseFlags() {
+	if len(os.Args) > 1 && os.Args[1] == reportCommand {
+		command = reportCommand
+		initReport(os.Args[2:])
+		return
+	}
+	required := []string{"ydb"}
 	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	flagSet.Usage = func() {
 		out := flagSet.Output()
-		_, _ = fmt.Fprintf(out, "Usage:\n%s [options] -url=URL1 [-url=URL2 -url=URL3]\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "Usage:\n%s [options] -url=URL1 [-url=URL2 -url=URL3] [-probes=probes.json]\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "%s %s [options]\n", os.Args[0], reportCommand)
 		_, _ = fmt.Fprintf(out, "\nOptions:\n")
 		flagSet.PrintDefaults()
 	}
@@ -56,13 +78,53 @@ func init() {
 		"url",
 		"url for health check",
 	)
+	flagSet.StringVar(&probesFile,
+		"probes", "",
+		"JSON file with probes definitions",
+	)
+	flagSet.IntVar(&retries,
+		"retries", defaultRetries,
+		"count of retries of failed probe before it is recorded as down",
+	)
+	flagSet.DurationVar(&retryBackoff,
+		"retry-backoff", defaultRetryBackoff,
+		"delay before first retry, doubles for every next retry",
+	)
+	flagSet.IntVar(&flapThreshold,
+		"flap-threshold", defaultFlapThreshold,
+		"count of consecutive checks with new state which are needed for up/down notification",
+	)
+	flagSet.BoolVar(&notifyStdout,
+		"notify-stdout", false,
+		"print up/down notifications as JSON lines to stdout",
+	)
+	flagSet.Var(&webhooks,
+		"notify-webhook",
+		"url which receives up/down notifications as JSON POST requests (may be repeated)",
+	)
 	flagSet.IntVar(&count,
 		"count", 0,
-		"count of needed checks (one check per minute, -1 for busy loop, 0 for single shot)",
+		"count of needed checks of every url (-1 for endless loop, 0 for single shot)",
 	)
 	flagSet.DurationVar(&interval,
 		"interval", time.Minute,
-		"interval between checks",
+		"default interval between checks of url",
+	)
+	flagSet.Float64Var(&jitter,
+		"jitter", 0.1,
+		"max random deviation of interval between checks as a fraction of interval, from 0 to 1",
+	)
+	flagSet.IntVar(&concurrency,
+		"concurrency", defaultConcurrency,
+		"max count of simultaneously running checks",
+	)
+	flagSet.IntVar(&batchSize,
+		"batch-size", defaultBatchSize,
+		"max count of results written by one bulk upsert",
+	)
+	flagSet.DurationVar(&flushInterval,
+		"flush-interval", defaultFlushInterval,
+		"max delay of results writing",
 	)
 	if err := flagSet.Parse(os.Args[1:]); err != nil {
 		flagSet.Usage()
@@ -75,6 +137,14 @@ func init() {
 			}
 		}
 	})
+	if jitter < 0 || jitter > 1 || concurrency < 1 || batchSize < 1 || flushInterval <= 0 || interval <= 0 {
+		fmt.Printf("\nInvalid options: jitter must be in [0, 1], other values must be positive\n\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if len(urls.urls) == 0 && probesFile == "" {
+		required = append(required, "url or probes")
+	}
 	if len(required) > 0 {
 		fmt.Printf("\nSome required options not defined: %v\n\n", required)
 		flagSet.Usage()
@@ -83,26 +153,53 @@ func init() {
 }
 
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
+	parseFlags()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
+	if command == reportCommand {
+		s, err := getService(ctx, dsn, environ.WithEnvironCredentials(ctx))
+		if err != nil {
+			panic(fmt.Errorf("error on create service: %w", err))
+		}
+		defer s.Close(ctx)
+		if err = runReport(ctx, s); err != nil {
+			panic(fmt.Errorf("error on report: %w", err))
+		}
+		return
+	}
+	probes, err := newProbes(urls.urls)
+	if err != nil {
+		panic(err)
+	}
+	if probesFile != "" {
+		more, err := loadProbes(probesFile)
+		if err != nil {
+			panic(fmt.Errorf("error on load probes: %w", err))
+		}
+		probes = append(probes, more...)
+	}
+	if err = checkNames(probes); err != nil {
+		panic(err)
+	}
 	s, err := getService(ctx, dsn, environ.WithEnvironCredentials(ctx))
 	if err != nil {
 		panic(fmt.Errorf("error on create service: %w", err))
 	}
 	defer s.Close(ctx)
-	for i := 0; ; i++ {
-		fmt.Println("check " + strconv.Itoa(i) + ":")
-		if err := s.check(ctx, urls.urls); err != nil {
-			panic(fmt.Errorf("error on check URLS: %w", err))
-		}
-		if count >= 0 && i == count {
-			return
-		}
-		select {
-		case <-time.After(interval):
-			continue
-		case <-ctx.Done():
-			return
-		}
+	s.retries = retries
+	s.retryBackoff = retryBackoff
+	s.tracker = newStateTracker(flapThreshold)
+	s.notifiers = newNotifiers(notifyStdout, webhooks.urls)
+	s.concurrency = concurrency
+	s.batchSize = batchSize
+	s.flushInterval = flushInterval
+	if count == 0 {
+		err = s.check(ctx, probes)
+	} else {
+		err = s.schedule(ctx, probes, interval, jitter, count)
+	}
+	if err != nil {
+		panic(fmt.Errorf("error on check URLS: %w", err))
 	}
 }
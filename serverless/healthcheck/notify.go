@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+// stateHistory is a count of the last checks of probe from which its state is restored
+const stateHistory = 20
+
+// state is a health state of probed url
+type state string
+
+const (
+	stateUnknown state = "unknown"
+	stateUp      state = "up"
+	stateDown    state = "down"
+)
+
+// event is a transition of health state of probe
+type event struct {
+	Probe string    `json:"probe"`
+	URL   string    `json:"url"`
+	From  state     `json:"from"`
+	To    state     `json:"to"`
+	Time  time.Time `json:"time"`
+	Code  int32     `json:"code"`
+	Error string    `json:"error,omitempty"`
+}
+
+// notifier delivers state transition events
+type notifier interface {
+	Notify(ctx context.Context, e event) error
+}
+
+// stdoutNotifier writes events as JSON lines
+type stdoutNotifier struct {
+	m sync.Mutex
+	w io.Writer
+}
+
+func (n *stdoutNotifier) Notify(_ context.Context, e event) error {
+	n.m.Lock()
+	defer n.m.Unlock()
+	return json.NewEncoder(n.w).Encode(e)
+}
+
+// webhookNotifier posts events as JSON to url
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, e event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("webhook '%s' responded with status %d", n.url, response.StatusCode)
+	}
+	return nil
+}
+
+// newNotifiers returns notifiers which print events to stdout and post them to webhooks
+func newNotifiers(stdout bool, webhooks []string) (notifiers []notifier) {
+	if stdout {
+		notifiers = append(notifiers, &stdoutNotifier{w: os.Stdout})
+	}
+	for _, u := range webhooks {
+		notifiers = append(notifiers, &webhookNotifier{
+			url:    u,
+			client: &http.Client{Timeout: defaultProbeTimeout},
+		})
+	}
+	return notifiers
+}
+
+// envNotifications reads flap threshold and notifiers from environment variables of serverless function
+func envNotifications() (threshold int, notifiers []notifier, err error) {
+	threshold = defaultFlapThreshold
+	if v := os.Getenv("FLAP_THRESHOLD"); v != "" {
+		if threshold, err = strconv.Atoi(v); err != nil {
+			return threshold, nil, fmt.Errorf("bad FLAP_THRESHOLD: %w", err)
+		}
+	}
+	stdout := false
+	if v := os.Getenv("NOTIFY_STDOUT"); v != "" {
+		if stdout, err = strconv.ParseBool(v); err != nil {
+			return threshold, nil, fmt.Errorf("bad NOTIFY_STDOUT: %w", err)
+		}
+	}
+	var webhooks []string
+	for _, u := range strings.Split(os.Getenv("NOTIFY_WEBHOOKS"), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			webhooks = append(webhooks, u)
+		}
+	}
+	return threshold, newNotifiers(stdout, webhooks), nil
+}
+
+// probeState is a tracked state of probe and the streak of results which differ from it
+type probeState struct {
+	state  state
+	streak int
+}
+
+// apply applies result of probe to state, from is a previous state if transition happened
+func (st *probeState) apply(passed bool, threshold int) (from state, changed bool) {
+	to := stateDown
+	if passed {
+		to = stateUp
+	}
+	if to == st.state {
+		st.streak = 0
+		return st.state, false
+	}
+	st.streak++
+	if st.streak < threshold {
+		return st.state, false
+	}
+	from = st.state
+	st.state, st.streak = to, 0
+	return from, true
+}
+
+// stateTracker detects state transitions of probes, probes of the same url are tracked separately. Transition
+// happens only after threshold consecutive results of the new state, so flapping probe does not flood notifiers.
+type stateTracker struct {
+	m         sync.Mutex
+	threshold int
+	states    map[string]*probeState
+}
+
+func newStateTracker(threshold int) *stateTracker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &stateTracker{
+		threshold: threshold,
+		states:    make(map[string]*probeState),
+	}
+}
+
+// tracked reports whether state of probe is tracked
+func (t *stateTracker) tracked(probe string) bool {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	_, ok := t.states[probe]
+	return ok
+}
+
+// restore sets state of probe from its previous results in time order, their transitions are not reported
+func (t *stateTracker) restore(probe string, history []bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	st := &probeState{state: stateUnknown}
+	for _, passed := range history {
+		st.apply(passed, t.threshold)
+	}
+	t.states[probe] = st
+}
+
+// observe applies results and returns happened transitions. Initial transition to up is not reported.
+func (t *stateTracker) observe(results []result) (events []event) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	for _, res := range results {
+		st, ok := t.states[res.probe]
+		if !ok {
+			st = &probeState{state: stateUnknown}
+			t.states[res.probe] = st
+		}
+		from, changed := st.apply(res.passed, t.threshold)
+		if !changed || (from == stateUnknown && st.state == stateUp) {
+			continue
+		}
+		e := event{
+			Probe: res.probe,
+			URL:   res.url,
+			From:  from,
+			To:    st.state,
+			Time:  res.ts,
+			Code:  res.code,
+		}
+		if res.err != nil {
+			e.Error = res.err.Error()
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// restoreState restores state of probe which is not tracked yet from its last checks before res, so state
+// survives restarts, single shot runs and serverless invocations
+func (s *service) restoreState(ctx context.Context, res result) {
+	if s.tracker.tracked(res.probe) {
+		return
+	}
+	history, err := s.selectLastChecks(ctx, res, stateHistory)
+	if err != nil {
+		fmt.Println("restore state of '" + res.probe + "' failed: " + err.Error())
+		return
+	}
+	s.tracker.restore(res.probe, history)
+}
+
+// selectLastChecks returns passed flags of up to limit last checks of probe before res in time order
+func (s *service) selectLastChecks(ctx context.Context, res result, limit int) (history []bool, err error) {
+	query := fmt.Sprintf(`
+		PRAGMA TablePathPrefix("%s");
+
+		DECLARE $url AS Text;
+		DECLARE $probe AS Text;
+		DECLARE $ts AS Datetime;
+		DECLARE $limit AS Uint64;
+
+		SELECT ts, passed FROM healthchecks
+		WHERE url = $url AND probe = $probe AND ts < $ts
+		ORDER BY url DESC, probe DESC, ts DESC LIMIT $limit;`, path.Join(s.db.Name(), prefix),
+	)
+	readTx := table.TxControl(table.BeginTx(table.WithOnlineReadOnly()), table.CommitTx())
+	err = s.db.Table().Do(ctx,
+		func(ctx context.Context, session table.Session) (err error) {
+			history = history[:0]
+			_, rs, err := session.Execute(ctx, readTx, query, table.NewQueryParameters(
+				table.ValueParam("$url", types.TextValue(res.url)),
+				table.ValueParam("$probe", types.TextValue(res.probe)),
+				table.ValueParam("$ts", types.DatetimeValueFromTime(res.ts)),
+				table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+			))
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = rs.Close()
+			}()
+			for rs.NextResultSet(ctx) {
+				for rs.NextRow() {
+					var passed bool
+					if err = rs.ScanNamed(named.OptionalWithDefault("passed", &passed)); err != nil {
+						return err
+					}
+					history = append(history, passed)
+				}
+			}
+			return rs.Err()
+		},
+		table.WithIdempotent(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return history, nil
+}
+
+// notify delivers events to all notifiers, delivery errors are printed and don't fail the check
+func (s *service) notify(ctx context.Context, events []event) {
+	for _, e := range events {
+		for _, n := range s.notifiers {
+			if err := n.Notify(ctx, e); err != nil {
+				fmt.Println("notify '" + e.Probe + "' failed: " + err.Error())
+			}
+		}
+	}
+}
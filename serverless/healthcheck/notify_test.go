@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStateTrackerObserve(t *testing.T) {
+	tracker := newStateTracker(2)
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	res := func(probe string, passed bool) result {
+		r := result{probe: probe, url: "https://ydb.tech/", ts: ts, passed: passed, code: 200}
+		if !passed {
+			r.code, r.err = 502, errors.New("unexpected status 502")
+		}
+		return r
+	}
+
+	for i, tt := range []struct {
+		results []result
+		events  []event
+	}{
+		// initial transition to up is not reported
+		{results: []result{res("get", true), res("get", true)}},
+		// single failure is a flap
+		{results: []result{res("get", false), res("get", true)}},
+		// probes of the same url are tracked separately
+		{
+			results: []result{res("get", false), res("head", false), res("get", false), res("head", false)},
+			events: []event{
+				{Probe: "get", URL: "https://ydb.tech/", From: stateUp, To: stateDown, Time: ts, Code: 502,
+					Error: "unexpected status 502"},
+				{Probe: "head", URL: "https://ydb.tech/", From: stateUnknown, To: stateDown, Time: ts, Code: 502,
+					Error: "unexpected status 502"},
+			},
+		},
+		{
+			results: []result{res("get", true), res("get", true)},
+			events: []event{
+				{Probe: "get", URL: "https://ydb.tech/", From: stateDown, To: stateUp, Time: ts, Code: 200},
+			},
+		},
+	} {
+		events := tracker.observe(tt.results)
+		if len(events) != len(tt.events) {
+			t.Fatalf("step %d: unexpected events %+v, want %+v", i, events, tt.events)
+		}
+		for j := range events {
+			if events[j] != tt.events[j] {
+				t.Fatalf("step %d: unexpected event %+v, want %+v", i, events[j], tt.events[j])
+			}
+		}
+	}
+}
+
+func TestStateTrackerRestore(t *testing.T) {
+	ts := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	down := result{probe: "get", url: "https://ydb.tech/", ts: ts, code: 502, err: errors.New("unexpected status 502")}
+
+	tracker := newStateTracker(2)
+	if tracker.tracked("get") {
+		t.Fatal("new tracker tracks probe")
+	}
+	// previous invocation has seen the first failure after up state
+	tracker.restore("get", []bool{false, true, true, false})
+	if !tracker.tracked("get") {
+		t.Fatal("restored probe is not tracked")
+	}
+	events := tracker.observe([]result{down})
+	if len(events) != 1 || events[0].From != stateUp || events[0].To != stateDown {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	// transition of history is already reported by previous invocation
+	tracker = newStateTracker(2)
+	tracker.restore("get", []bool{true, true, false, false})
+	if events = tracker.observe([]result{down}); len(events) != 0 {
+		t.Fatalf("transition is reported twice: %+v", events)
+	}
+}
+
+func TestEnvNotifications(t *testing.T) {
+	t.Setenv("FLAP_THRESHOLD", "3")
+	t.Setenv("NOTIFY_STDOUT", "true")
+	t.Setenv("NOTIFY_WEBHOOKS", "https://example.com/a, https://example.com/b")
+	threshold, notifiers, err := envNotifications()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if threshold != 3 || len(notifiers) != 3 {
+		t.Fatalf("unexpected threshold %d and %d notifiers", threshold, len(notifiers))
+	}
+	if w, ok := notifiers[2].(*webhookNotifier); !ok || w.url != "https://example.com/b" {
+		t.Fatalf("unexpected notifier: %+v", notifiers[2])
+	}
+
+	t.Setenv("FLAP_THRESHOLD", "two")
+	if _, _, err = envNotifications(); err == nil {
+		t.Fatal("bad threshold is accepted")
+	}
+}
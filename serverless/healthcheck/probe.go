@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultProbeTimeout = 10 * time.Second
+
+	// maxProbeBody is a max size of response body which is checked by probe
+	maxProbeBody = 1 << 20
+)
+
+// duration is a time.Duration which is represented in JSON as a Go duration string
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// statusRange is an inclusive range of expected http status codes
+type statusRange struct {
+	min, max int
+}
+
+// parseStatusRange parses single status code ("200") or range of codes ("200-399")
+func parseStatusRange(s string) (r statusRange, err error) {
+	from, to := s, s
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		from, to = s[:i], s[i+1:]
+	}
+	if r.min, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+		return r, fmt.Errorf("invalid status range '%s'", s)
+	}
+	if r.max, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+		return r, fmt.Errorf("invalid status range '%s'", s)
+	}
+	if r.min > r.max {
+		return r, fmt.Errorf("invalid status range '%s'", s)
+	}
+	return r, nil
+}
+
+func (r statusRange) contains(code int) bool {
+	return code >= r.min && code <= r.max
+}
+
+// probe is a definition of one health check
+type probe struct {
+	// Name identifies probe in results and notifications, default is method and url like "GET https://ya.ru",
+	// so probes of the same url with different methods or expectations must have different names
+	Name    string            `json:"name,omitempty"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Status is an expected status code or range of codes like "200-299", default is "200-399"
+	Status string `json:"status,omitempty"`
+	// BodyContains is a substring which response body must contain
+	BodyContains string `json:"body_contains,omitempty"`
+	// BodyRegexp is a regular expression which response body must match
+	BodyRegexp string   `json:"body_regexp,omitempty"`
+	Timeout    duration `json:"timeout,omitempty"`
+	// Interval is an interval between checks, default is -interval flag value
+	Interval duration `json:"interval,omitempty"`
+	// Insecure disables verification of server TLS certificate
+	Insecure bool `json:"insecure,omitempty"`
+
+	status statusRange
+	body   *regexp.Regexp
+}
+
+// init validates probe and fills defaults
+func (p *probe) init() (err error) {
+	uri, err := url.Parse(p.URL)
+	if err != nil {
+		return err
+	}
+	if uri.Scheme == "" {
+		uri, err = url.Parse("http://" + p.URL)
+		if err != nil {
+			return err
+		}
+	}
+	p.URL = uri.String()
+	if p.Method == "" {
+		p.Method = http.MethodGet
+	}
+	if p.Name == "" {
+		p.Name = p.Method + " " + p.URL
+	}
+	if p.Status == "" {
+		p.Status = "200-399"
+	}
+	if p.status, err = parseStatusRange(p.Status); err != nil {
+		return err
+	}
+	if p.BodyRegexp != "" {
+		if p.body, err = regexp.Compile(p.BodyRegexp); err != nil {
+			return err
+		}
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = duration(defaultProbeTimeout)
+	}
+	return nil
+}
+
+// newProbes makes default probes from urls, each url may contain several space separated urls
+func newProbes(urls []string) (probes []probe, err error) {
+	for _, u := range urls {
+		for _, f := range strings.Fields(u) {
+			p := probe{URL: f}
+			if err = p.init(); err != nil {
+				return nil, fmt.Errorf("invalid url '%s': %w", f, err)
+			}
+			probes = append(probes, p)
+		}
+	}
+	return probes, nil
+}
+
+// parseProbes reads JSON array of probes
+func parseProbes(r io.Reader) (probes []probe, err error) {
+	if err = json.NewDecoder(r).Decode(&probes); err != nil {
+		return nil, err
+	}
+	for i := range probes {
+		if err = probes[i].init(); err != nil {
+			return nil, fmt.Errorf("invalid probe '%s': %w", probes[i].URL, err)
+		}
+	}
+	return probes, nil
+}
+
+// checkNames checks that names of probes are unique, results of probes with the same name would overwrite
+// each other
+func checkNames(probes []probe) error {
+	names := make(map[string]struct{}, len(probes))
+	for i := range probes {
+		if _, ok := names[probes[i].Name]; ok {
+			return fmt.Errorf("duplicate probe '%s', set unique name of probe", probes[i].Name)
+		}
+		names[probes[i].Name] = struct{}{}
+	}
+	return nil
+}
+
+// loadProbes reads probes from JSON file
+func loadProbes(fileName string) ([]probe, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return parseProbes(f)
+}
+
+// result is an outcome of one probe run
+type result struct {
+	probe   string
+	url     string
+	code    int32
+	ts      time.Time
+	latency time.Duration
+	// certExpiry is the earliest expiration time of server certificates chain, nil for plain http
+	certExpiry *time.Time
+	passed     bool
+	err        error
+}
+
+// run executes probe once. Failed expectations are reported in result error, not as returned error.
+func (p *probe) run(ctx context.Context, client *http.Client) (res result) {
+	res = result{
+		probe: p.Name,
+		url:   p.URL,
+		code:  -1,
+		ts:    time.Now(),
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.Timeout))
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, p.Method, p.URL, nil)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	for k, v := range p.Headers {
+		request.Header.Set(k, v)
+	}
+	start := time.Now()
+	response, err := client.Do(request)
+	if err != nil {
+		res.latency = time.Since(start)
+		res.err = err
+		return res
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxProbeBody))
+	res.latency = time.Since(start)
+	res.code = int32(response.StatusCode)
+	if response.TLS != nil {
+		for _, cert := range response.TLS.PeerCertificates {
+			if res.certExpiry == nil || cert.NotAfter.Before(*res.certExpiry) {
+				notAfter := cert.NotAfter
+				res.certExpiry = &notAfter
+			}
+		}
+	}
+	switch {
+	case err != nil:
+		res.err = fmt.Errorf("read body failed: %w", err)
+	case !p.status.contains(response.StatusCode):
+		res.err = fmt.Errorf("unexpected status %d, expected %s", response.StatusCode, p.Status)
+	case p.BodyContains != "" && !strings.Contains(string(body), p.BodyContains):
+		res.err = fmt.Errorf("body does not contain '%s'", p.BodyContains)
+	case p.body != nil && !p.body.Match(body):
+		res.err = fmt.Errorf("body does not match '%s'", p.BodyRegexp)
+	default:
+		res.passed = true
+	}
+	return res
+}
+
+// String returns one line description of result for console output
+func (r result) String() string {
+	out := " > '" + r.probe + "' => "
+	if r.code > 0 {
+		out += strconv.Itoa(int(r.code)) + " "
+	}
+	out += r.latency.Round(time.Millisecond).String()
+	if r.certExpiry != nil {
+		out += ", certificate expires " + r.certExpiry.Format(time.RFC3339)
+	}
+	if r.passed {
+		return out + ", passed"
+	}
+	return out + ", failed: " + r.err.Error()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStatusRange(t *testing.T) {
+	for _, tt := range []struct {
+		s        string
+		expected statusRange
+		err      bool
+	}{
+		{s: "200", expected: statusRange{min: 200, max: 200}},
+		{s: "200-399", expected: statusRange{min: 200, max: 399}},
+		{s: " 200 - 299 ", expected: statusRange{min: 200, max: 299}},
+		{s: "399-200", err: true},
+		{s: "2xx", err: true},
+		{s: "200-", err: true},
+		{s: "", err: true},
+	} {
+		t.Run(tt.s, func(t *testing.T) {
+			r, err := parseStatusRange(tt.s)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("invalid range is parsed: %+v", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r != tt.expected {
+				t.Fatalf("unexpected range: %+v, want %+v", r, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProbeNames(t *testing.T) {
+	probes, err := parseProbes(strings.NewReader(`[
+		{"url": "ydb.tech"},
+		{"url": "ydb.tech", "method": "HEAD"},
+		{"url": "ydb.tech", "name": "docs", "body_contains": "docs"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"GET http://ydb.tech", "HEAD http://ydb.tech", "docs"} {
+		if probes[i].Name != name {
+			t.Fatalf("probe %d has name '%s', want '%s'", i, probes[i].Name, name)
+		}
+	}
+	if err = checkNames(probes); err != nil {
+		t.Fatal(err)
+	}
+	if err = checkNames(append(probes, probes[0])); err == nil {
+		t.Fatal("duplicate probe is accepted")
+	}
+}
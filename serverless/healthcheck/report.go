@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+const reportCommand = "report"
+
+var (
+	reportWindow   time.Duration
+	reportTo       string
+	reportFormat   string
+	reportPageSize int
+	reportClusters int
+)
+
+func initReport(args []string) {
+	required := []string{"ydb"}
+	flagSet := flag.NewFlagSet(os.Args[0]+" "+reportCommand, flag.ExitOnError)
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		_, _ = fmt.Fprintf(out, "Usage:\n%s %s [options] [-url=URL1 -url=URL2]\n", os.Args[0], reportCommand)
+		_, _ = fmt.Fprintf(out, "\nOptions:\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.StringVar(&dsn,
+		"ydb", "",
+		"YDB connection string",
+	)
+	flagSet.StringVar(&prefix,
+		"prefix", "",
+		"tables prefix",
+	)
+	flagSet.Var(&urls,
+		"url",
+		"url for report, all urls are reported if not set",
+	)
+	flagSet.DurationVar(&reportWindow,
+		"window", 24*time.Hour,
+		"duration of reported time window",
+	)
+	flagSet.StringVar(&reportTo,
+		"to", "",
+		"end of reported time window in RFC3339 format, default is now",
+	)
+	flagSet.StringVar(&reportFormat,
+		"format", "table",
+		"output format: table, json or csv",
+	)
+	flagSet.IntVar(&reportPageSize,
+		"page-size", 1000,
+		"count of rows read by one request",
+	)
+	flagSet.IntVar(&reportClusters,
+		"clusters", 3,
+		"count of the most frequent error clusters reported per url",
+	)
+	if err := flagSet.Parse(args); err != nil {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	flagSet.Visit(func(f *flag.Flag) {
+		for i, arg := range required {
+			if arg == f.Name {
+				required = append(required[:i], required[i+1:]...)
+			}
+		}
+	})
+	if len(required) > 0 {
+		fmt.Printf("\nSome required options not defined: %v\n\n", required)
+		flagSet.Usage()
+		os.Exit(1)
+	}
+}
+
+// checkRow is a row of healthchecks table
+type checkRow struct {
+	url     string
+	probe   string
+	ts      time.Time
+	code    int32
+	err     string
+	latency *time.Duration
+	passed  bool
+}
+
+// selectChecksPage reads next page of checks in [from, to) time window after (lastURL, lastProbe, lastTs) key,
+// checks of the next urls are read only if sameURL is false
+func (s *service) selectChecksPage(
+	ctx context.Context, from, to time.Time, limit int, sameURL bool, lastURL, lastProbe string, lastTs time.Time,
+) (rows []checkRow, err error) {
+	// every part is a range of primary key: the rest of the last probe, the next probes of the last url
+	// and the next urls
+	nextURLs := `
+		$part3 = (
+			SELECT * FROM healthchecks
+			WHERE url > $lastURL AND ts >= $from AND ts < $to
+			ORDER BY url, probe, ts LIMIT $limit
+		);`
+	union := "UNION ALL SELECT * FROM $part3"
+	if sameURL {
+		nextURLs, union = "", ""
+	}
+	query := fmt.Sprintf(`
+		PRAGMA TablePathPrefix("%s");
+
+		DECLARE $limit AS Uint64;
+		DECLARE $from AS DateTime;
+		DECLARE $to AS DateTime;
+		DECLARE $lastURL AS Text;
+		DECLARE $lastProbe AS Text;
+		DECLARE $lastTs AS DateTime;
+
+		$part1 = (
+			SELECT * FROM healthchecks
+			WHERE url = $lastURL AND probe = $lastProbe AND ts > $lastTs AND ts < $to
+			ORDER BY url, probe, ts LIMIT $limit
+		);
+
+		$part2 = (
+			SELECT * FROM healthchecks
+			WHERE url = $lastURL AND probe > $lastProbe AND ts >= $from AND ts < $to
+			ORDER BY url, probe, ts LIMIT $limit
+		);
+		%s
+
+		$union = (
+			SELECT * FROM $part1
+			UNION ALL
+			SELECT * FROM $part2
+			%s
+		);
+
+		SELECT url, probe, ts, code, error, latency, passed FROM $union
+		ORDER BY url, probe, ts LIMIT $limit;`, path.Join(s.db.Name(), prefix), nextURLs, union,
+	)
+	readTx := table.TxControl(table.BeginTx(table.WithOnlineReadOnly()), table.CommitTx())
+	err = s.db.Table().Do(ctx,
+		func(ctx context.Context, session table.Session) (err error) {
+			rows = rows[:0]
+			_, res, err := session.Execute(ctx, readTx, query,
+				table.NewQueryParameters(
+					table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+					table.ValueParam("$from", types.DatetimeValueFromTime(from)),
+					table.ValueParam("$to", types.DatetimeValueFromTime(to)),
+					table.ValueParam("$lastURL", types.TextValue(lastURL)),
+					table.ValueParam("$lastProbe", types.TextValue(lastProbe)),
+					table.ValueParam("$lastTs", types.DatetimeValueFromTime(lastTs)),
+				),
+			)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = res.Close()
+			}()
+			for res.NextResultSet(ctx) {
+				for res.NextRow() {
+					var row checkRow
+					err = res.ScanNamed(
+						named.OptionalWithDefault("url", &row.url),
+						named.OptionalWithDefault("probe", &row.probe),
+						named.OptionalWithDefault("ts", &row.ts),
+						named.OptionalWithDefault("code", &row.code),
+						named.OptionalWithDefault("error", &row.err),
+						named.Optional("latency", &row.latency),
+						named.OptionalWithDefault("passed", &row.passed),
+					)
+					if err != nil {
+						return err
+					}
+					rows = append(rows, row)
+				}
+			}
+			return res.Err()
+		},
+	)
+	return rows, err
+}
+
+// errorCluster is a group of failed checks with similar errors
+type errorCluster struct {
+	Error string    `json:"error"`
+	Count int       `json:"count"`
+	First time.Time `json:"first"`
+	Last  time.Time `json:"last"`
+}
+
+// urlReport is an uptime report of one probe of url
+type urlReport struct {
+	URL           string         `json:"url"`
+	Probe         string         `json:"probe"`
+	Checks        int            `json:"checks"`
+	Failed        int            `json:"failed"`
+	Uptime        float64        `json:"uptime_percent"`
+	LongestOutage time.Duration  `json:"longest_outage_ns"`
+	OutageStart   *time.Time     `json:"outage_start,omitempty"`
+	LatencyP50    time.Duration  `json:"latency_p50_ns"`
+	LatencyP95    time.Duration  `json:"latency_p95_ns"`
+	ErrorClusters []errorCluster `json:"error_clusters,omitempty"`
+
+	latencies   []time.Duration
+	downSince   *time.Time
+	lastTs      time.Time
+	clusters    map[string]*errorCluster
+	maxClusters int
+}
+
+// errorNumbers are numbers in error messages, they are masked so errors which differ only by
+// status codes, ports or addresses fall into one cluster
+var errorNumbers = regexp.MustCompile(`[0-9]+`)
+
+func clusterKey(err string) string {
+	return errorNumbers.ReplaceAllString(err, "N")
+}
+
+func newURLReport(url, probe string, maxClusters int) *urlReport {
+	return &urlReport{
+		URL:         url,
+		Probe:       probe,
+		clusters:    make(map[string]*errorCluster),
+		maxClusters: maxClusters,
+	}
+}
+
+// add applies check to report, checks must be added in time order
+func (r *urlReport) add(row *checkRow) {
+	r.Checks++
+	r.lastTs = row.ts
+	if row.latency != nil {
+		r.latencies = append(r.latencies, *row.latency)
+	}
+	if row.passed {
+		r.closeOutage(row.ts)
+		return
+	}
+	r.Failed++
+	if r.downSince == nil {
+		ts := row.ts
+		r.downSince = &ts
+	}
+	key := clusterKey(row.err)
+	c, ok := r.clusters[key]
+	if !ok {
+		c = &errorCluster{
+			Error: key,
+			First: row.ts,
+		}
+		r.clusters[key] = c
+	}
+	c.Count++
+	c.Last = row.ts
+}
+
+// closeOutage finishes current outage at ts
+func (r *urlReport) closeOutage(ts time.Time) {
+	if r.downSince == nil {
+		return
+	}
+	if d := ts.Sub(*r.downSince); d > r.LongestOutage || r.OutageStart == nil {
+		r.LongestOutage = d
+		r.OutageStart = r.downSince
+	}
+	r.downSince = nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// finish computes aggregates after all checks are added, not finished outage lasts till the last check
+func (r *urlReport) finish() {
+	r.closeOutage(r.lastTs)
+	if r.Checks > 0 {
+		r.Uptime = float64(r.Checks-r.Failed) * 100 / float64(r.Checks)
+	}
+	sort.Slice(r.latencies, func(i, j int) bool {
+		return r.latencies[i] < r.latencies[j]
+	})
+	r.LatencyP50 = percentile(r.latencies, 0.5)
+	r.LatencyP95 = percentile(r.latencies, 0.95)
+	for _, c := range r.clusters {
+		r.ErrorClusters = append(r.ErrorClusters, *c)
+	}
+	sort.Slice(r.ErrorClusters, func(i, j int) bool {
+		if r.ErrorClusters[i].Count != r.ErrorClusters[j].Count {
+			return r.ErrorClusters[i].Count > r.ErrorClusters[j].Count
+		}
+		return r.ErrorClusters[i].First.Before(r.ErrorClusters[j].First)
+	})
+	if len(r.ErrorClusters) > r.maxClusters {
+		r.ErrorClusters = r.ErrorClusters[:r.maxClusters]
+	}
+}
+
+// report pages through checks in [from, to) window and builds reports per probe of url.
+// Empty filter means all urls, otherwise only checks of filtered urls are read.
+func (s *service) report(
+	ctx context.Context, from, to time.Time, filter []string, pageSize int, maxClusters int,
+) (reports []*urlReport, err error) {
+	if len(filter) == 0 {
+		return s.reportURL(ctx, from, to, "", pageSize, maxClusters)
+	}
+	wanted := make(map[string]struct{}, len(filter))
+	for _, u := range filter {
+		wanted[u] = struct{}{}
+	}
+	sorted := make([]string, 0, len(wanted))
+	for u := range wanted {
+		sorted = append(sorted, u)
+	}
+	sort.Strings(sorted)
+	for _, u := range sorted {
+		more, err := s.reportURL(ctx, from, to, u, pageSize, maxClusters)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, more...)
+	}
+	return reports, nil
+}
+
+// reportURL pages through checks of url and builds reports per its probe, empty url means all urls
+func (s *service) reportURL(
+	ctx context.Context, from, to time.Time, url string, pageSize int, maxClusters int,
+) (reports []*urlReport, err error) {
+	var (
+		current   *urlReport
+		lastURL   = url
+		lastProbe string
+		lastTs    time.Time
+	)
+	for {
+		rows, err := s.selectChecksPage(ctx, from, to, pageSize, url != "", lastURL, lastProbe, lastTs)
+		if err != nil {
+			return nil, err
+		}
+		for i := range rows {
+			row := &rows[i]
+			if current == nil || current.URL != row.url || current.Probe != row.probe {
+				if current != nil {
+					current.finish()
+				}
+				current = newURLReport(row.url, row.probe, maxClusters)
+				reports = append(reports, current)
+			}
+			current.add(row)
+		}
+		if len(rows) < pageSize {
+			break
+		}
+		last := rows[len(rows)-1]
+		lastURL, lastProbe, lastTs = last.url, last.probe, last.ts
+	}
+	if current != nil {
+		current.finish()
+	}
+	return reports, nil
+}
+
+func formatClusters(clusters []errorCluster) string {
+	parts := make([]string, 0, len(clusters))
+	for _, c := range clusters {
+		parts = append(parts, strconv.Itoa(c.Count)+"x "+c.Error)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func writeReports(w io.Writer, format string, reports []*urlReport) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	case "csv":
+		writer := csv.NewWriter(w)
+		_ = writer.Write([]string{
+			"url", "probe", "checks", "failed", "uptime_percent", "longest_outage", "outage_start",
+			"latency_p50", "latency_p95", "error_clusters",
+		})
+		for _, r := range reports {
+			outageStart := ""
+			if r.OutageStart != nil {
+				outageStart = r.OutageStart.Format(time.RFC3339)
+			}
+			_ = writer.Write([]string{
+				r.URL,
+				r.Probe,
+				strconv.Itoa(r.Checks),
+				strconv.Itoa(r.Failed),
+				strconv.FormatFloat(r.Uptime, 'f', 3, 64),
+				r.LongestOutage.String(),
+				outageStart,
+				r.LatencyP50.String(),
+				r.LatencyP95.String(),
+				formatClusters(r.ErrorClusters),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(writer, "URL\tPROBE\tCHECKS\tUPTIME\tLONGEST OUTAGE\tP50\tP95\tERRORS")
+		for _, r := range reports {
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%d\t%.3f%%\t%v\t%v\t%v\t%s\n",
+				r.URL, r.Probe, r.Checks, r.Uptime, r.LongestOutage,
+				r.LatencyP50.Round(time.Millisecond), r.LatencyP95.Round(time.Millisecond),
+				formatClusters(r.ErrorClusters),
+			)
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+}
+
+func runReport(ctx context.Context, s *service) error {
+	to := time.Now()
+	if reportTo != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, reportTo); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	filter := make([]string, 0, len(urls.urls))
+	for _, u := range urls.urls {
+		p := probe{URL: u}
+		if err := p.init(); err != nil {
+			return fmt.Errorf("invalid url '%s': %w", u, err)
+		}
+		filter = append(filter, p.URL)
+	}
+	reports, err := s.report(ctx, to.Add(-reportWindow), to, filter, reportPageSize, reportClusters)
+	if err != nil {
+		return err
+	}
+	return writeReports(os.Stdout, reportFormat, reports)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkAt(minute int, err string, latency time.Duration) *checkRow {
+	return &checkRow{
+		url:     "https://ydb.tech/",
+		probe:   "GET https://ydb.tech/",
+		ts:      time.Date(2023, 1, 1, 0, minute, 0, 0, time.UTC),
+		err:     err,
+		latency: &latency,
+		passed:  err == "",
+	}
+}
+
+func TestURLReport(t *testing.T) {
+	r := newURLReport("https://ydb.tech/", "GET https://ydb.tech/", 1)
+	for _, row := range []*checkRow{
+		checkAt(0, "", 10*time.Millisecond),
+		checkAt(1, "unexpected status 502, expected 200-399", 20*time.Millisecond),
+		checkAt(2, "unexpected status 503, expected 200-399", 30*time.Millisecond),
+		checkAt(3, "", 40*time.Millisecond),
+		checkAt(4, "dial tcp: connection refused", 50*time.Millisecond),
+	} {
+		r.add(row)
+	}
+	r.finish()
+
+	if r.Checks != 5 || r.Failed != 3 {
+		t.Fatalf("unexpected checks %d and failed %d", r.Checks, r.Failed)
+	}
+	if r.Uptime != 40 {
+		t.Fatalf("unexpected uptime: %v", r.Uptime)
+	}
+	if r.LongestOutage != 2*time.Minute || r.OutageStart == nil || !r.OutageStart.Equal(checkAt(1, "", 0).ts) {
+		t.Fatalf("unexpected longest outage %v since %v", r.LongestOutage, r.OutageStart)
+	}
+	if r.LatencyP50 != 30*time.Millisecond || r.LatencyP95 != 40*time.Millisecond {
+		t.Fatalf("unexpected latency p50 %v and p95 %v", r.LatencyP50, r.LatencyP95)
+	}
+	if len(r.ErrorClusters) != 1 {
+		t.Fatalf("unexpected error clusters: %+v", r.ErrorClusters)
+	}
+	if c := r.ErrorClusters[0]; c.Count != 2 || c.Error != "unexpected status N, expected N-N" {
+		t.Fatalf("unexpected the most frequent error cluster: %+v", c)
+	}
+}
+
+func TestURLReportOutageTillLastCheck(t *testing.T) {
+	r := newURLReport("https://ydb.tech/", "GET https://ydb.tech/", 3)
+	r.add(checkAt(0, "", time.Millisecond))
+	r.add(checkAt(5, "timeout", time.Millisecond))
+	r.add(checkAt(15, "timeout", time.Millisecond))
+	r.finish()
+
+	if r.LongestOutage != 10*time.Minute {
+		t.Fatalf("unexpected longest outage: %v", r.LongestOutage)
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	r := newURLReport("https://ydb.tech/", "ping", 3)
+	r.add(checkAt(0, "", time.Millisecond))
+	r.finish()
+	for _, format := range []string{"table", "json", "csv"} {
+		buf := &bytes.Buffer{}
+		if err := writeReports(buf, format, []*urlReport{r}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "ping") {
+			t.Fatalf("%s report has no probe: %s", format, buf.String())
+		}
+	}
+	if err := writeReports(&bytes.Buffer{}, "xml", nil); err == nil {
+		t.Fatal("unknown format is written")
+	}
+}
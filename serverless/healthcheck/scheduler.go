@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+const (
+	defaultConcurrency   = 64
+	defaultBatchSize     = 1000
+	defaultFlushInterval = 5 * time.Second
+
+	// writeTimeout limits writing of one batch, it doesn't depend on check context, so
+	// results are flushed on shutdown too
+	writeTimeout = 30 * time.Second
+)
+
+// scheduledProbe is a probe with its schedule state
+type scheduledProbe struct {
+	*probe
+	// running is 1 while probe is queued or being checked
+	running int32
+}
+
+// jittered returns interval randomly changed by up to jitter fraction of it
+func jittered(interval time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	delta := (rand.Float64()*2 - 1) * jitter * float64(interval) //nolint:gosec
+	return interval + time.Duration(delta)
+}
+
+// runWorkers starts bounded pool of workers which check probes from jobs until jobs is closed.
+// Results channel is closed after all workers exit. After ctx is done queued jobs are not started
+// and results of running ones are dropped, because checks are failed by cancel rather than by server.
+func (s *service) runWorkers(ctx context.Context, jobs <-chan *scheduledProbe, workers int) <-chan result {
+	results := make(chan result, workers)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				if ctx.Err() != nil {
+					atomic.StoreInt32(&p.running, 0)
+					continue
+				}
+				res := s.runWithRetries(ctx, p.probe)
+				atomic.StoreInt32(&p.running, 0)
+				if ctx.Err() != nil {
+					continue
+				}
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+func (s *service) workersFor(probes []probe) int {
+	if s.concurrency < len(probes) {
+		return s.concurrency
+	}
+	return len(probes)
+}
+
+// check runs every probe once
+func (s *service) check(ctx context.Context, probes []probe) error {
+	if len(probes) == 0 {
+		return nil
+	}
+	jobs := make(chan *scheduledProbe, len(probes))
+	for i := range probes {
+		jobs <- &scheduledProbe{probe: &probes[i]}
+	}
+	close(jobs)
+	return s.writeResults(ctx, s.runWorkers(ctx, jobs, s.workersFor(probes)))
+}
+
+// schedule checks every probe with its own interval (or defaultInterval) until ctx is done or
+// every probe is checked count+1 times, negative count means no limit. First check of probe happens
+// at random moment of its first interval, so checks are spread in time. Check which is still running
+// when the next one is due is not piled up, the next one is skipped.
+func (s *service) schedule(
+	ctx context.Context, probes []probe, defaultInterval time.Duration, jitter float64, count int,
+) error {
+	if len(probes) == 0 {
+		return nil
+	}
+	jobs := make(chan *scheduledProbe, len(probes))
+	results := s.runWorkers(ctx, jobs, s.workersFor(probes))
+	tickers := &sync.WaitGroup{}
+	for i := range probes {
+		p := &scheduledProbe{probe: &probes[i]}
+		interval := time.Duration(p.Interval)
+		if interval <= 0 {
+			interval = defaultInterval
+		}
+		tickers.Add(1)
+		go func() {
+			defer tickers.Done()
+			timer := time.NewTimer(time.Duration(rand.Int63n(int64(interval) + 1))) //nolint:gosec
+			defer timer.Stop()
+			for runs := 0; count < 0 || runs <= count; {
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+				if atomic.CompareAndSwapInt32(&p.running, 0, 1) {
+					jobs <- p
+					runs++
+				} else {
+					fmt.Println(" > '" + p.Name + "' => skipped, previous check is still running")
+				}
+				timer.Reset(jittered(interval, jitter))
+			}
+		}()
+	}
+	go func() {
+		tickers.Wait()
+		close(jobs)
+	}()
+	return s.writeResults(ctx, results)
+}
+
+// writeResults prints results, notifies about state transitions and writes results to healthchecks
+// table by batches of batchSize rows or every flushInterval. Write errors are printed, the last one is
+// returned after results channel is closed.
+func (s *service) writeResults(ctx context.Context, results <-chan result) (err error) {
+	var (
+		batch = make([]result, 0, s.batchSize)
+		flush = time.NewTicker(s.flushInterval)
+	)
+	defer flush.Stop()
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		writeCtx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+		defer cancel()
+		if writeErr := s.bulkUpsertResults(writeCtx, batch); writeErr != nil {
+			fmt.Println("write results failed: " + writeErr.Error())
+			err = writeErr
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case res, ok := <-results:
+			if !ok {
+				write()
+				return err
+			}
+			fmt.Println(res.String())
+			if len(s.notifiers) > 0 {
+				s.restoreState(ctx, res)
+				s.notify(ctx, s.tracker.observe([]result{res}))
+			}
+			batch = append(batch, res)
+			if len(batch) >= s.batchSize {
+				write()
+			}
+		case <-flush.C:
+			write()
+		}
+	}
+}
+
+func (s *service) bulkUpsertResults(ctx context.Context, results []result) (err error) {
+	rows := make([]types.Value, len(results))
+	for i, res := range results {
+		certExpiry := types.NullValue(types.TypeTimestamp)
+		if res.certExpiry != nil {
+			certExpiry = types.OptionalValue(types.TimestampValueFromTime(*res.certExpiry))
+		}
+		rows[i] = types.StructValue(
+			types.StructFieldValue("url", types.TextValue(res.url)),
+			types.StructFieldValue("probe", types.TextValue(res.probe)),
+			types.StructFieldValue("code", types.Int32Value(res.code)),
+			types.StructFieldValue("ts", types.DatetimeValueFromTime(res.ts)),
+			types.StructFieldValue("error", types.TextValue(func(err error) string {
+				if err != nil {
+					return err.Error()
+				}
+				return ""
+			}(res.err))),
+			types.StructFieldValue("latency", types.IntervalValueFromDuration(res.latency)),
+			types.StructFieldValue("cert_expires_at", certExpiry),
+			types.StructFieldValue("passed", types.BoolValue(res.passed)),
+		)
+	}
+	err = s.db.Table().Do(ctx,
+		func(ctx context.Context, session table.Session) (err error) {
+			return session.BulkUpsert(ctx, path.Join(s.db.Name(), prefix, "healthchecks"), types.ListValue(rows...))
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("error on upsert rows: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRunWorkersDropsCanceledChecks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	probes, err := newProbes([]string{server.URL, server.URL + "/queued"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &service{client: server.Client(), retries: 2, retryBackoff: time.Millisecond}
+	jobs := make(chan *scheduledProbe, len(probes))
+	for i := range probes {
+		jobs <- &scheduledProbe{probe: &probes[i]}
+	}
+	close(jobs)
+	results := s.runWorkers(ctx, jobs, 1)
+
+	<-started
+	cancel()
+	for res := range results {
+		t.Fatalf("result of canceled check is recorded: %v", res)
+	}
+	select {
+	case <-started:
+		t.Fatal("queued check is started after cancel")
+	default:
+	}
+}
@@ -5,10 +5,8 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
-	"net/url"
 	"os"
 	"path"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,12 +15,33 @@ import (
 	"github.com/ydb-platform/ydb-go-sdk/v3"
 	"github.com/ydb-platform/ydb-go-sdk/v3/sugar"
 	"github.com/ydb-platform/ydb-go-sdk/v3/table"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+const (
+	defaultRetries       = 2
+	defaultRetryBackoff  = time.Second
+	defaultFlapThreshold = 2
 )
 
 type service struct {
-	db     ydb.Connection
-	client *http.Client
+	db ydb.Connection
+	// client verifies server certificates, insecureClient is used by probes which skip verification
+	client         *http.Client
+	insecureClient *http.Client
+
+	// retries is a count of additional attempts of failed probe, delay between attempts starts
+	// from retryBackoff and doubles after every attempt
+	retries      int
+	retryBackoff time.Duration
+
+	tracker   *stateTracker
+	notifiers []notifier
+
+	// concurrency is a max count of simultaneously running checks
+	concurrency int
+	// results are written by batches of batchSize rows or every flushInterval
+	batchSize     int
+	flushInterval time.Duration
 }
 
 var (
@@ -33,14 +52,21 @@ var (
 func getService(ctx context.Context, dsn string, opts ...ydb.Option) (s *service, err error) {
 	once.Do(func() {
 		s = &service{
-			client: &http.Client{
+			client: &http.Client{},
+			insecureClient: &http.Client{
 				Transport: &http.Transport{
 					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: true,
+						InsecureSkipVerify: true, //nolint:gosec
 					},
 				},
-				Timeout: time.Second * 10,
 			},
+			retries:      defaultRetries,
+			retryBackoff: defaultRetryBackoff,
+			tracker:      newStateTracker(defaultFlapThreshold),
+
+			concurrency:   defaultConcurrency,
+			batchSize:     defaultBatchSize,
+			flushInterval: defaultFlushInterval,
 		}
 		s.db, err = ydb.Open(ctx, dsn, opts...)
 		if err != nil {
@@ -64,26 +90,34 @@ func (s *service) Close(ctx context.Context) {
 	defer func() { _ = s.db.Close(ctx) }()
 }
 
+// primaryKey is a primary key of healthchecks table, results of different probes of the same url are kept apart
+var primaryKey = []string{"url", "probe", "ts"}
+
 func (s *service) createTableIfNotExists(ctx context.Context) error {
-	exists, err := sugar.IsTableExists(ctx, s.db.Scheme(), path.Join(s.db.Name(), prefix, "healthchecks"))
+	tablePath := path.Join(s.db.Name(), prefix, "healthchecks")
+	exists, err := sugar.IsTableExists(ctx, s.db.Scheme(), tablePath)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return nil
+		return s.checkPrimaryKey(ctx, tablePath)
 	}
 	query := fmt.Sprintf(`
 		PRAGMA TablePathPrefix("%s");
 
 		CREATE TABLE healthchecks (
-			url         Text,
-			code        Int32,
-			ts          DateTime,
-			error       Text,
-			PRIMARY KEY (url, ts)
+			url             Text,
+			probe           Text,
+			code            Int32,
+			ts              DateTime,
+			error           Text,
+			latency         Interval,
+			cert_expires_at Timestamp,
+			passed          Bool,
+			PRIMARY KEY (%s)
 		) WITH (
 			AUTO_PARTITIONING_BY_LOAD = ENABLED
-		);`, path.Join(s.db.Name(), prefix),
+		);`, path.Join(s.db.Name(), prefix), strings.Join(primaryKey, ", "),
 	)
 	return s.db.Table().Do(ctx,
 		func(ctx context.Context, s table.Session) error {
@@ -92,106 +126,48 @@ func (s *service) createTableIfNotExists(ctx context.Context) error {
 	)
 }
 
-func (s *service) ping(path string) (code int32, err error) {
-	uri, err := url.Parse(path)
-	if err != nil {
-		return -1, err
-	}
-	if uri.Scheme == "" {
-		uri.Scheme = "http"
-	}
-	request, err := http.NewRequest(http.MethodGet, uri.String(), nil)
-	if err != nil {
-		return -1, err
-	}
-	response, err := s.client.Do(request)
-	if err != nil {
-		return -1, err
-	}
-	return int32(response.StatusCode), nil
-}
-
-type row struct {
-	url  string
-	code int32
-	err  error
+// checkPrimaryKey checks that existing healthchecks table has probe in primary key. Primary key can't be altered,
+// so table which was created before probe names must be migrated manually.
+func (s *service) checkPrimaryKey(ctx context.Context, tablePath string) error {
+	return s.db.Table().Do(ctx,
+		func(ctx context.Context, session table.Session) error {
+			description, err := session.DescribeTable(ctx, tablePath)
+			if err != nil {
+				return err
+			}
+			if strings.Join(description.PrimaryKey, ",") != strings.Join(primaryKey, ",") {
+				return fmt.Errorf("table '%s' has primary key (%s) instead of (%s), migrate it as described in README",
+					tablePath, strings.Join(description.PrimaryKey, ", "), strings.Join(primaryKey, ", "),
+				)
+			}
+			return nil
+		},
+	)
 }
 
-func (s *service) check(ctx context.Context, urls []string) error {
-	if len(urls) == 0 {
-		return nil
+// client returns http client which satisfies TLS settings of probe
+func (s *service) clientFor(p *probe) *http.Client {
+	if p.Insecure {
+		return s.insecureClient
 	}
-	wg := &sync.WaitGroup{}
-	rows := make([]row, len(urls))
-	for idx := range urls {
-		for _, u := range strings.Split(urls[idx], " ") {
-			wg.Add(1)
-			go func(idx int) {
-				defer wg.Done()
-				out := " > '" + u + "' => "
-				code, err := s.ping(u)
-				if err != nil {
-					fmt.Println(out + err.Error())
-				} else {
-					fmt.Println(out + strconv.Itoa(int(code)))
-				}
-				rows[idx] = row{
-					url:  urls[idx],
-					code: code,
-					err:  err,
-				}
-			}(idx)
-		}
-	}
-	wg.Wait()
-
-	return s.upsertRows(ctx, rows)
+	return s.client
 }
 
-func (s *service) upsertRows(ctx context.Context, rows []row) (err error) {
-	values := make([]types.Value, len(rows))
-	for i, row := range rows {
-		values[i] = types.StructValue(
-			types.StructFieldValue("url", types.TextValue(row.url)),
-			types.StructFieldValue("code", types.Int32Value(row.code)),
-			types.StructFieldValue("ts", types.DatetimeValueFromTime(time.Now())),
-			types.StructFieldValue("error", types.TextValue(func(err error) string {
-				if err != nil {
-					return err.Error()
-				}
-				return ""
-			}(row.err))),
-		)
-	}
-	err = s.db.Table().Do(ctx,
-		func(ctx context.Context, session table.Session) (err error) {
-			_, _, err = session.Execute(ctx,
-				table.SerializableReadWriteTxControl(table.CommitTx()),
-				fmt.Sprintf(`
-					PRAGMA TablePathPrefix("%s");
-			
-					DECLARE $rows AS List<Struct<
-						url: Text,
-						code: Int32,
-						ts: DateTime,
-						error: Text
-					>>;
-
-					UPSERT INTO healthchecks ( url, code, ts, error )
-					SELECT url, code, ts, error FROM AS_TABLE($rows);`,
-					path.Join(s.db.Name(), prefix),
-				),
-				table.NewQueryParameters(
-					table.ValueParam("$rows", types.ListValue(values...)),
-				),
-			)
-			return err
-		},
-	)
-	if err != nil {
-		return fmt.Errorf("error on upsert rows: %w", err)
+// runWithRetries runs probe until it passes or attempts are exhausted, the last result is returned
+func (s *service) runWithRetries(ctx context.Context, p *probe) (res result) {
+	backoff := s.retryBackoff
+	for attempt := 0; ; attempt++ {
+		res = p.run(ctx, s.clientFor(p))
+		if res.passed || attempt >= s.retries {
+			return res
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return res
+		}
 	}
-	return nil
 }
 
 // Serverless is an entrypoint for serverless yandex function
@@ -207,5 +183,27 @@ func Serverless(ctx context.Context) error {
 		return fmt.Errorf("error on create service: %w", err)
 	}
 	defer s.Close(ctx)
-	return s.check(ctx, strings.Split(os.Getenv("URLS"), ","))
+	probes, err := newProbes(strings.Split(os.Getenv("URLS"), ","))
+	if err != nil {
+		return err
+	}
+	if env := os.Getenv("PROBES"); env != "" {
+		more, err := parseProbes(strings.NewReader(env))
+		if err != nil {
+			return fmt.Errorf("error on parse probes: %w", err)
+		}
+		probes = append(probes, more...)
+	}
+	if err = checkNames(probes); err != nil {
+		return err
+	}
+	threshold, notifiers, err := envNotifications()
+	if err != nil {
+		return err
+	}
+	// state of probes is restored from healthchecks table on every invocation, because other instances of
+	// function check probes too
+	s.tracker = newStateTracker(threshold)
+	s.notifiers = notifiers
+	return s.check(ctx, probes)
 }
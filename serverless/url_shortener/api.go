@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 1000
+)
+
+// apiLinkRequest is a body of create link request
+type apiLinkRequest struct {
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	TTL   string `json:"ttl,omitempty"`
+}
+
+// apiLink is a link representation in JSON API
+type apiLink struct {
+	Hash      string     `json:"hash"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// apiLinks is a page of links, Next is a cursor for the next page
+type apiLinks struct {
+	Links []apiLink `json:"links"`
+	Next  string    `json:"next,omitempty"`
+}
+
+// apiError is a body of error response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	setRetryAfter(w, err)
+	writeJSON(w, statusOf(err), apiError{Error: err.Error()})
+}
+
+func (s *service) handleAPISpec(w http.ResponseWriter, r *http.Request) {
+	spec, err := static.ReadFile("static/openapi.json")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeResponse(w, http.StatusOK, string(spec))
+}
+
+func (s *service) handleAPICreateLink(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		body []byte
+		req  apiLinkRequest
+		link storedLink
+	)
+	body, err = s.readCreateRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err = json.Unmarshal(body, &req); err != nil {
+		err = fmt.Errorf("%w: %s", errBadRequest, err.Error())
+		writeError(w, err)
+		return
+	}
+	link, err = s.createLink(r.Context(), req.URL, req.Alias, req.TTL)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/links/"+link.hash)
+	writeJSON(w, http.StatusCreated, apiLink{
+		Hash:      link.hash,
+		URL:       link.src,
+		ExpiresAt: link.expiresAt,
+	})
+}
+
+func (s *service) handleAPIGetLink(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		link storedLink
+	)
+	link, err = s.store.SelectLink(r.Context(), mux.Vars(r)["hash"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiLink{
+		Hash:      link.hash,
+		URL:       link.src,
+		ExpiresAt: link.expiresAt,
+	})
+}
+
+func (s *service) handleAPIListLinks(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		links []storedLink
+		limit = defaultListLimit
+	)
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			err = fmt.Errorf("%w: '%s' is not a valid limit", errBadRequest, l)
+			writeError(w, err)
+			return
+		}
+	}
+	links, err = s.store.ListLinks(r.Context(), r.URL.Query().Get("after"), limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page := apiLinks{
+		Links: make([]apiLink, 0, len(links)),
+	}
+	for i := range links {
+		page.Links = append(page.Links, apiLink{
+			Hash:      links[i].hash,
+			URL:       links[i].src,
+			ExpiresAt: links[i].expiresAt,
+		})
+	}
+	if len(links) == limit {
+		page.Next = links[len(links)-1].hash
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (s *service) handleAPIDeleteLink(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+	err = s.deleteLink(r.Context(), mux.Vars(r)["hash"])
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
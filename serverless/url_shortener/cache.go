@@ -0,0 +1,273 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicsugar"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topictypes"
+)
+
+// changefeedName is a name of urls table changefeed, which used for cache invalidation
+const changefeedName = "updates"
+
+// linkCache is an in-process LRU cache of links by hash
+type linkCache struct {
+	m        sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+
+	// version is incremented by every invalidation, removed holds versions of links removed while some links
+	// are loading and purged is a version of the last purge, so links invalidated during loading aren't added
+	version uint64
+	loading int
+	removed map[string]uint64
+	purged  uint64
+
+	hits          prometheus.Counter
+	misses        prometheus.Counter
+	evictions     prometheus.Counter
+	invalidations prometheus.Counter
+}
+
+type linkCacheEntry struct {
+	hash string
+	link storedLink
+}
+
+func newLinkCache(capacity int, registry *prometheus.Registry) *linkCache {
+	newCounter := func(name string) prometheus.Counter {
+		c := prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "app",
+			Subsystem: "cache",
+			Name:      name,
+		})
+		registry.MustRegister(c)
+		return c
+	}
+	return &linkCache{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element, capacity),
+		removed:  make(map[string]uint64),
+
+		hits:          newCounter("hits"),
+		misses:        newCounter("misses"),
+		evictions:     newCounter("evictions"),
+		invalidations: newCounter("invalidations"),
+	}
+}
+
+// Get returns not expired link from cache
+func (c *linkCache) Get(hash string) (storedLink, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.items[hash]
+	if !ok {
+		c.misses.Inc()
+		return storedLink{}, false
+	}
+	entry := e.Value.(*linkCacheEntry)
+	if entry.link.isExpired(time.Now()) {
+		c.order.Remove(e)
+		delete(c.items, hash)
+		c.misses.Inc()
+		return storedLink{}, false
+	}
+	c.order.MoveToFront(e)
+	c.hits.Inc()
+	return entry.link, true
+}
+
+// Load returns link from cache or loads it with load and puts it into cache. Link isn't cached if it is
+// invalidated while loading, otherwise stale link loaded before removal would be cached after it.
+func (c *linkCache) Load(hash string, load func() (storedLink, error)) (storedLink, error) {
+	if link, ok := c.Get(hash); ok {
+		return link, nil
+	}
+	c.m.Lock()
+	version := c.version
+	c.loading++
+	c.m.Unlock()
+
+	link, err := load()
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.loading--
+	if err == nil && c.purged <= version && c.removed[hash] <= version {
+		c.add(hash, link)
+	}
+	if c.loading == 0 {
+		c.removed = make(map[string]uint64)
+	}
+	return link, err
+}
+
+// add puts link into cache and evicts least recently used link if cache is full
+func (c *linkCache) add(hash string, link storedLink) {
+	if e, ok := c.items[hash]; ok {
+		e.Value.(*linkCacheEntry).link = link
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[hash] = c.order.PushFront(&linkCacheEntry{
+		hash: hash,
+		link: link,
+	})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*linkCacheEntry).hash)
+		c.evictions.Inc()
+	}
+}
+
+// Remove drops link from cache
+func (c *linkCache) Remove(hash string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.version++
+	if c.loading > 0 {
+		c.removed[hash] = c.version
+	}
+	if e, ok := c.items[hash]; ok {
+		c.order.Remove(e)
+		delete(c.items, hash)
+		c.invalidations.Inc()
+	}
+}
+
+// Purge drops all links from cache
+func (c *linkCache) Purge() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.version++
+	c.purged = c.version
+	c.order.Init()
+	c.items = make(map[string]*list.Element, c.capacity)
+	c.invalidations.Inc()
+}
+
+// enableCache turns on links cache, which invalidated by urls changefeed read with consumer.
+// Every running instance of service must use its own consumer, otherwise instances share changes.
+func (s *service) enableCache(ctx context.Context, size int, consumer string) error {
+	if consumer == "" {
+		return fmt.Errorf("consumer of changefeed is required")
+	}
+	if err := s.addChangefeedIfNotExists(ctx); err != nil {
+		return fmt.Errorf("add changefeed failed: %w", err)
+	}
+	topicPath := path.Join(s.db.Name(), prefix, "urls", changefeedName)
+	description, err := s.db.Topic().Describe(ctx, topicPath)
+	if err != nil {
+		return fmt.Errorf("describe changefeed failed: %w", err)
+	}
+	exists := false
+	for i := range description.Consumers {
+		if description.Consumers[i].Name == consumer {
+			exists = true
+		}
+	}
+	if !exists {
+		err = s.db.Topic().Alter(ctx, topicPath, topicoptions.AlterWithAddConsumers(topictypes.Consumer{
+			Name: consumer,
+		}))
+		if err != nil {
+			return fmt.Errorf("add consumer failed: %w", err)
+		}
+	}
+	s.cache = newLinkCache(size, s.registry)
+	go s.invalidateCache(ctx, topicPath, consumer)
+	return nil
+}
+
+// addChangefeedIfNotExists adds changefeed to urls table, it is needed only for cache invalidation
+func (s *service) addChangefeedIfNotExists(ctx context.Context) error {
+	tablePath := path.Join(s.db.Name(), prefix, "urls")
+	return s.db.Table().Do(ctx,
+		func(ctx context.Context, session table.Session) error {
+			description, err := session.DescribeTable(ctx, tablePath)
+			if err != nil {
+				return err
+			}
+			for _, c := range description.Changefeeds {
+				if c.Name == changefeedName {
+					return nil
+				}
+			}
+			return session.ExecuteSchemeQuery(ctx, fmt.Sprintf(`
+				ALTER TABLE
+					`+"`%s`"+`
+				ADD CHANGEFEED
+					%s
+				WITH (
+					FORMAT = 'JSON',
+					MODE = 'KEYS_ONLY'
+				);`, tablePath, changefeedName,
+			))
+		},
+	)
+}
+
+// invalidateCache drops changed links from cache. On read errors cache is purged, because some
+// changes may be lost, and reading is restarted.
+func (s *service) invalidateCache(ctx context.Context, topicPath string, consumer string) {
+	for ctx.Err() == nil {
+		err := s.readChangefeed(ctx, topicPath, consumer)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Msg("read changefeed failed, purge cache")
+		s.cache.Purge()
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *service) readChangefeed(ctx context.Context, topicPath string, consumer string) error {
+	reader, err := s.db.Topic().StartReader(consumer, topicoptions.ReadSelectors{
+		{
+			Path:     topicPath,
+			ReadFrom: time.Now(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = reader.Close(context.Background())
+	}()
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		var event struct {
+			Key []string `json:"key"`
+		}
+		if err = topicsugar.JSONUnmarshal(msg, &event); err != nil {
+			return err
+		}
+		if len(event.Key) > 0 {
+			s.cache.Remove(event.Key[0])
+		}
+		if err = reader.Commit(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
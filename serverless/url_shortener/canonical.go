@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts are ports which are dropped from canonical url
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// trackingParams are query parameters which are stripped from canonical url if stripping is enabled.
+// Keys which end with '_' are prefixes.
+var trackingParams = []string{
+	"utm_",
+	"fbclid",
+	"gclid",
+	"yclid",
+	"ysclid",
+	"mc_cid",
+	"mc_eid",
+	"_openstat",
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range trackingParams {
+		if strings.HasSuffix(p, "_") && strings.HasPrefix(key, p) || key == p {
+			return true
+		}
+	}
+	return false
+}
+
+// stripTrackingParams removes tracking parameters from raw query, order of other parameters is kept
+func stripTrackingParams(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		key := pair
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			key = pair[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if pair != "" && !isTrackingParam(key) {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// canonicalURL validates absolute http(s) url and returns its canonical form, so equivalent urls
+// are mapped to the same short code: scheme and host are lower-cased, international domain names
+// are converted to punycode, default port and trailing slash of path are dropped.
+func canonicalURL(raw string, stripTracking bool) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return nil, fmt.Errorf("scheme must be http or https")
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return nil, fmt.Errorf("host is empty")
+	}
+	if u.User != nil {
+		return nil, fmt.Errorf("user info is not allowed")
+	}
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); ip == nil {
+		host, err = idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host: %w", err)
+		}
+	}
+	if host == "" {
+		return nil, fmt.Errorf("host is empty")
+	}
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return nil, fmt.Errorf("invalid port '%s'", port)
+		}
+	}
+	if port != "" || strings.Contains(host, ":") {
+		u.Host = strings.TrimSuffix(net.JoinHostPort(host, port), ":")
+	} else {
+		u.Host = host
+	}
+	escapedPath := strings.TrimRight(u.EscapedPath(), "/")
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	if u.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return nil, err
+	}
+	u.RawPath = escapedPath
+	if stripTracking {
+		u.RawQuery = stripTrackingParams(u.RawQuery)
+	}
+	u.ForceQuery = false
+	return u, nil
+}
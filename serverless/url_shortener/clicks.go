@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+func (s *service) handleStats(w http.ResponseWriter, r *http.Request) {
+	var (
+		err   error
+		stats linkStats
+	)
+	hash := mux.Vars(r)["hash"]
+	if _, err = s.store.SelectLink(r.Context(), hash); err != nil {
+		writeResponse(w, statusOf(err), err.Error())
+		return
+	}
+	stats, err = s.store.SelectStats(r.Context(), hash)
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	body, err := json.Marshal(stats)
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeResponse(w, http.StatusOK, string(body))
+}
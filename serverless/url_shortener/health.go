@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// readinessTimeout limits the time of store check in readiness probe
+const readinessTimeout = time.Second
+
+// handleHealthz is a liveness probe, it succeeds while process is able to serve http
+func (s *service) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, "ok")
+}
+
+// handleReadyz is a readiness probe, it fails while service is shutting down or store is unavailable
+func (s *service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&s.draining) != 0 {
+		writeResponse(w, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	if err := s.store.Ping(ctx); err != nil {
+		writeResponse(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeResponse(w, http.StatusOK, "ok")
+}
+
+// drain makes readiness probe fail, so new requests are not routed to this instance
+func (s *service) drain() {
+	atomic.StoreInt32(&s.draining, 1)
+}
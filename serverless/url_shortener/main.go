@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -20,12 +22,23 @@ var (
 	port             int
 	sessionPoolLimit int
 	shutdownAfter    time.Duration
+	shutdownTimeout  time.Duration
+	shutdownDelay    time.Duration
 	logLevel         string
+	cacheSize        int
+	cacheConsumer    string
+	rateLimit        float64
+	rateBurst        int
+	maxBodySize      int64
+	deniedDomains    = domainList{}
+	apiKeys          = keySet{}
+	stripTracking    bool
 
 	log = zerolog.New(os.Stdout).With().Timestamp().Logger()
 )
 
-func init() {
+// parseFlags parses command line options, it is not called in serverless mode and tests
+func parseFlags() {
 	required := []string{"ydb"}
 	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	flagSet.Usage = func() {
@@ -54,10 +67,50 @@ func init() {
 		"session-pool-limit", 50,
 		"session pool size limit",
 	)
+	flagSet.IntVar(&cacheSize,
+		"cache-size", 0,
+		"links cache size, 0 for disable cache",
+	)
+	flagSet.StringVar(&cacheConsumer,
+		"cache-consumer", "",
+		"changefeed consumer for cache invalidation, required with cache, must be unique for every running instance",
+	)
+	flagSet.Float64Var(&rateLimit,
+		"rate-limit", 1,
+		"links creations per second allowed for one client (ip address or api key), 0 for disable limiter",
+	)
+	flagSet.IntVar(&rateBurst,
+		"rate-burst", 10,
+		"links creations burst allowed for one client",
+	)
+	flagSet.Int64Var(&maxBodySize,
+		"max-body-size", defaultMaxBodySize,
+		"max size of links creation request body in bytes",
+	)
+	flagSet.Var(deniedDomains,
+		"deny-domain",
+		"target domain which links are rejected, also denies its subdomains (may be repeated)",
+	)
+	flagSet.Var(apiKeys,
+		"api-key",
+		"api key which identifies client by X-API-Key header for rate limiter instead of ip address (may be repeated)",
+	)
+	flagSet.BoolVar(&stripTracking,
+		"strip-tracking", true,
+		"strip tracking query parameters (utm_*, fbclid, gclid, ...) from links",
+	)
 	flagSet.DurationVar(&shutdownAfter,
 		"shutdown-after", -1,
 		"duration for shutdown after start",
 	)
+	flagSet.DurationVar(&shutdownTimeout,
+		"shutdown-timeout", 30*time.Second,
+		"max duration of in-flight requests draining on shutdown",
+	)
+	flagSet.DurationVar(&shutdownDelay,
+		"shutdown-delay", 0,
+		"duration of serving with failing readiness probe before draining, lets balancer exclude instance",
+	)
 	if err := flagSet.Parse(os.Args[1:]); err != nil {
 		flagSet.Usage()
 		os.Exit(1)
@@ -69,6 +122,9 @@ func init() {
 			}
 		}
 	})
+	if cacheSize > 0 && cacheConsumer == "" {
+		required = append(required, "cache-consumer")
+	}
 	if len(required) > 0 {
 		fmt.Printf("\nSome required options not defined: %v\n\n", required)
 		flagSet.Usage()
@@ -82,15 +138,19 @@ func init() {
 }
 
 func main() {
+	parseFlags()
+
 	var (
 		ctx    context.Context
 		cancel context.CancelFunc
-		done   = make(chan struct{})
+		done   = make(chan error, 1)
 	)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 	if shutdownAfter > 0 {
-		ctx, cancel = context.WithTimeout(context.Background(), shutdownAfter)
+		ctx, cancel = context.WithTimeout(ctx, shutdownAfter)
 	} else {
-		ctx, cancel = context.WithCancel(context.Background())
+		ctx, cancel = context.WithCancel(ctx)
 	}
 	defer cancel()
 
@@ -104,25 +164,46 @@ func main() {
 		fmt.Println("Create service failed. Re-run with flag '-log-level=warn' and see logs")
 		os.Exit(1)
 	}
-	defer s.Close(ctx)
+	defer s.Close(context.Background())
+
+	s.protect(protection{
+		rateLimit:     rateLimit,
+		rateBurst:     rateBurst,
+		maxBodySize:   maxBodySize,
+		deniedDomains: deniedDomains,
+		apiKeys:       apiKeys,
+	})
+	s.stripTracking = stripTracking
+
+	if cacheSize > 0 {
+		if err = s.enableCache(ctx, cacheSize, cacheConsumer); err != nil {
+			log.Error().Err(err).Msg("enable cache failed")
+			os.Exit(1)
+		}
+	}
 
 	server := &http.Server{
 		Addr:    ":" + strconv.Itoa(port),
 		Handler: s.router,
 	}
-	defer func() {
-		_ = server.Shutdown(ctx)
-	}()
 
 	go func() {
-		_ = server.ListenAndServe()
-		close(done)
+		done <- server.ListenAndServe()
 	}()
 
 	select {
-	case <-ctx.Done():
-		return
-	case <-done:
+	case err = <-done:
+		log.Error().Err(err).Msg("http server failed")
 		return
+	case <-ctx.Done():
+	}
+
+	log.Info().Dur("timeout", shutdownTimeout).Msg("shutting down, draining in-flight requests")
+	s.drain()
+	time.Sleep(shutdownDelay)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+	if err = server.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("http server shutdown failed")
 	}
 }
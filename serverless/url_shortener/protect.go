@@ -0,0 +1,296 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	// defaultMaxBodySize is a default limit of links creation request body
+	defaultMaxBodySize = 8 << 10
+
+	// apiKeyHeader is a header which identifies client instead of its ip address, only keys from configured
+	// list are accepted, so clients can't bypass limiter by random keys
+	apiKeyHeader = "X-API-Key"
+
+	// rejection reasons of app_rejections_total metric
+	reasonRateLimit    = "rate_limit"
+	reasonBodyTooLarge = "body_too_large"
+	reasonDeniedDomain = "denied_domain"
+)
+
+// tokenBucket is a state of one client in rateLimiter
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token-bucket rate limiter keyed by client
+type rateLimiter struct {
+	m         sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// newRateLimiter creates limiter which allows rate requests per second with bursts of burst requests
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token from bucket of key and reports whether request is allowed
+func (l *rateLimiter) Allow(key string) bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{
+			tokens: l.burst,
+			last:   now,
+		}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// wait returns delay after which bucket of key has a token
+func (l *rateLimiter) wait(key string) time.Duration {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok || b.tokens >= 1 || l.rate <= 0 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep drops buckets which are refilled completely, such clients are indistinguishable from new ones
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientKey identifies client of request by known api key or by ip address
+func (s *service) clientKey(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		if _, ok := s.apiKeys[key]; ok {
+			return "key:" + key
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// keySet is a set of api keys, it is usable as repeatable flag
+type keySet map[string]struct{}
+
+func (k keySet) String() string {
+	return fmt.Sprintf("%d keys", len(k))
+}
+
+func (k keySet) Set(key string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return fmt.Errorf("empty api key")
+	}
+	k[key] = struct{}{}
+	return nil
+}
+
+// domainList is a set of domains, each domain also matches its subdomains
+type domainList map[string]struct{}
+
+func (l domainList) String() string {
+	domains := make([]string, 0, len(l))
+	for d := range l {
+		domains = append(domains, d)
+	}
+	return strings.Join(domains, ",")
+}
+
+// Set adds domain to list, it makes domainList usable as repeatable flag
+func (l domainList) Set(domain string) error {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return fmt.Errorf("empty domain")
+	}
+	if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+		domain = ascii
+	}
+	l[domain] = struct{}{}
+	return nil
+}
+
+// Contains reports whether host or one of its parent domains is in list
+func (l domainList) Contains(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for host != "" {
+		if _, ok := l[host]; ok {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			return false
+		}
+		host = host[i+1:]
+	}
+	return false
+}
+
+// rateLimitedError is errRateLimited with delay after which client may retry
+type rateLimitedError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("%v: retry after %v", errRateLimited, e.retryAfter.Round(time.Millisecond))
+}
+
+func (e *rateLimitedError) Unwrap() error {
+	return errRateLimited
+}
+
+// setRetryAfter sets Retry-After header in whole seconds if request is rate limited
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var limited *rateLimitedError
+	if errors.As(err, &limited) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.retryAfter.Seconds()))))
+	}
+}
+
+// reject counts rejection of request by reason and returns err
+func (s *service) reject(reason string, err error) error {
+	s.rejections.WithLabelValues(reason).Inc()
+	return err
+}
+
+// readCreateRequest checks that client is not rate limited and reads request body up to max body size
+func (s *service) readCreateRequest(r *http.Request) ([]byte, error) {
+	if key := s.clientKey(r); s.limiter != nil && !s.limiter.Allow(key) {
+		return nil, s.reject(reasonRateLimit, &rateLimitedError{retryAfter: s.limiter.wait(key)})
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, s.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > s.maxBodySize {
+		return nil, s.reject(reasonBodyTooLarge, fmt.Errorf("%w: limit is %d bytes", errBodyTooLarge, s.maxBodySize))
+	}
+	return body, nil
+}
+
+// checkDomain rejects links to denied domains
+func (s *service) checkDomain(host string) error {
+	if s.deniedDomains.Contains(host) {
+		return s.reject(reasonDeniedDomain, fmt.Errorf("%w: '%s'", errDeniedDomain, host))
+	}
+	return nil
+}
+
+// protection is a configuration of links creation protection
+type protection struct {
+	rateLimit     float64
+	rateBurst     int
+	maxBodySize   int64
+	deniedDomains domainList
+	apiKeys       keySet
+}
+
+// protect applies protection configuration to service
+func (s *service) protect(p protection) {
+	s.limiter = nil
+	if p.rateLimit > 0 {
+		s.limiter = newRateLimiter(p.rateLimit, p.rateBurst)
+	}
+	s.maxBodySize = p.maxBodySize
+	s.deniedDomains = p.deniedDomains
+	s.apiKeys = p.apiKeys
+}
+
+// envProtection reads protection configuration of serverless function from environment variables RATE_LIMIT,
+// RATE_BURST, MAX_BODY_SIZE, DENY_DOMAINS and API_KEYS, lists are comma separated. Defaults are the same as
+// defaults of flags.
+func envProtection() (p protection, err error) {
+	p = protection{
+		rateLimit:     1,
+		rateBurst:     10,
+		maxBodySize:   defaultMaxBodySize,
+		deniedDomains: domainList{},
+		apiKeys:       keySet{},
+	}
+	if v := os.Getenv("RATE_LIMIT"); v != "" {
+		if p.rateLimit, err = strconv.ParseFloat(v, 64); err != nil {
+			return p, fmt.Errorf("bad RATE_LIMIT: %w", err)
+		}
+	}
+	if v := os.Getenv("RATE_BURST"); v != "" {
+		if p.rateBurst, err = strconv.Atoi(v); err != nil {
+			return p, fmt.Errorf("bad RATE_BURST: %w", err)
+		}
+	}
+	if v := os.Getenv("MAX_BODY_SIZE"); v != "" {
+		if p.maxBodySize, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return p, fmt.Errorf("bad MAX_BODY_SIZE: %w", err)
+		}
+	}
+	for _, list := range []struct {
+		env    string
+		values flag.Value
+	}{
+		{env: "DENY_DOMAINS", values: p.deniedDomains},
+		{env: "API_KEYS", values: p.apiKeys},
+	} {
+		for _, v := range strings.Split(os.Getenv(list.env), ",") {
+			if strings.TrimSpace(v) == "" {
+				continue
+			}
+			if err = list.values.Set(v); err != nil {
+				return p, fmt.Errorf("bad %s: %w", list.env, err)
+			}
+		}
+	}
+	return p, nil
+}
@@ -1,16 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"embed"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/fnv"
-	"io"
 	"net/http"
 	"os"
-	"path"
 	"regexp"
 	"strings"
 	"sync"
@@ -21,32 +19,52 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/ydb-platform/ydb-go-examples/internal/httpmetrics"
+
 	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
 	ydbMetrics "github.com/ydb-platform/ydb-go-sdk-prometheus"
 	ydbZerolog "github.com/ydb-platform/ydb-go-sdk-zerolog"
 	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/result"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
 	"github.com/ydb-platform/ydb-go-sdk/v3/trace"
 )
 
 const (
 	invalidHashError = "'%s' is not a valid short path."
-	hashNotFound     = "hash '%s' is not found"
 	invalidURLError  = "'%s' is not a valid URL."
+	invalidAlias     = "'%s' is not a valid alias."
+	invalidTTL       = "'%s' is not a valid ttl."
+
+	// maxShortAttempts is a count of salted hashes tried before giving up on collisions
+	maxShortAttempts = 8
+)
+
+var (
+	errBadRequest   = errors.New("bad request")
+	errHashNotFound = errors.New("hash is not found")
+	errAliasTaken   = errors.New("alias is already taken")
+	errNoFreeShort  = errors.New("no free short code")
+	errRateLimited  = errors.New("too many requests")
+	errBodyTooLarge = errors.New("request body is too large")
+	errDeniedDomain = errors.New("domain is denied")
 )
 
 var (
-	//go:embed static/index.html
+	//go:embed static/index.html static/openapi.json
 	static embed.FS
 )
 
 var (
 	short = regexp.MustCompile(`[a-zA-Z0-9]{8}`)
-	long  = regexp.MustCompile(`https?://(?:[-\w.]|%[\da-fA-F]{2})+`)
+	alias = regexp.MustCompile(`^[a-zA-Z0-9_-]{4,32}$`)
+
+	// reservedAliases are paths which are served by the service itself
+	reservedAliases = map[string]struct{}{
+		"api":     {},
+		"healthz": {},
+		"metrics": {},
+		"readyz":  {},
+		"shorten": {},
+	}
 )
 
 func hash(s string) (string, error) {
@@ -62,78 +80,41 @@ func isShortCorrect(link string) bool {
 	return short.FindStringIndex(link) != nil
 }
 
-func isLongCorrect(link string) bool {
-	return long.FindStringIndex(link) != nil
-}
-
-func render(t *template.Template, data interface{}) string {
-	var buf bytes.Buffer
-	err := t.Execute(&buf, data)
-	if err != nil {
-		panic(err)
+func isAliasCorrect(a string) bool {
+	if _, reserved := reservedAliases[a]; reserved {
+		return false
 	}
-	return buf.String()
-}
-
-type templateConfig struct {
-	TablePathPrefix string
+	return alias.MatchString(a)
 }
 
 type service struct {
 	db       ydb.Connection
+	store    LinkStore
 	registry *prometheus.Registry
 	router   *mux.Router
-
-	calls        *prometheus.GaugeVec
-	callsLatency *prometheus.HistogramVec
-	callsErrors  *prometheus.GaugeVec
+	cache    *linkCache
+	draining int32
+
+	limiter       *rateLimiter
+	maxBodySize   int64
+	deniedDomains domainList
+	apiKeys       keySet
+	stripTracking bool
+	rejections    *prometheus.CounterVec
 }
 
 var (
 	s    *service
 	once sync.Once
+
+	// protectOnce applies protection configuration from environment to service of serverless function
+	protectOnce sync.Once
+	protectErr  error
 )
 
 func getService(ctx context.Context, dsn string, opts ...ydb.Option) (s *service, err error) {
 	once.Do(func() {
-		var (
-			registry = prometheus.NewRegistry()
-			calls    = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: "app",
-				Name:      "calls",
-			}, []string{
-				"method",
-				"success",
-			})
-			callsLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-				Namespace: "app",
-				Name:      "latency",
-				Buckets: []float64{
-					(1 * time.Millisecond).Seconds(),
-					(5 * time.Millisecond).Seconds(),
-					(10 * time.Millisecond).Seconds(),
-					(50 * time.Millisecond).Seconds(),
-					(100 * time.Millisecond).Seconds(),
-					(500 * time.Millisecond).Seconds(),
-					(1000 * time.Millisecond).Seconds(),
-					(5000 * time.Millisecond).Seconds(),
-					(10000 * time.Millisecond).Seconds(),
-				},
-			}, []string{
-				"success",
-				"method",
-			})
-			callsErrors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-				Namespace: "app",
-				Name:      "errors",
-			}, []string{
-				"method",
-			})
-		)
-
-		registry.MustRegister(calls)
-		registry.MustRegister(callsLatency)
-		registry.MustRegister(callsErrors)
+		registry := prometheus.NewRegistry()
 
 		opts = append(
 			opts,
@@ -150,34 +131,23 @@ func getService(ctx context.Context, dsn string, opts ...ydb.Option) (s *service
 			),
 		)
 
-		s = &service{
-			registry: registry,
-			router:   mux.NewRouter(),
-
-			calls:        calls,
-			callsLatency: callsLatency,
-			callsErrors:  callsErrors,
-		}
-
-		s.db, err = ydb.Open(ctx, dsn, opts...)
+		var db ydb.Connection
+		db, err = ydb.Open(ctx, dsn, opts...)
 		if err != nil {
 			err = fmt.Errorf("connect error: %w", err)
 			return
 		}
 
-		s.router.Handle("/metrics", promhttp.InstrumentMetricHandler(
-			registry, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
-		))
-		s.router.HandleFunc("/", s.handleIndex).Methods(http.MethodGet)
-		s.router.HandleFunc("/shorten", s.handleShorten).Methods(http.MethodPost)
-		s.router.HandleFunc("/{[0-9a-fA-F]{8}}", s.handleLonger).Methods(http.MethodGet)
-
-		err = s.createTable(ctx)
+		var store LinkStore
+		store, err = newYDBStore(ctx, db)
 		if err != nil {
-			_ = s.db.Close(ctx)
+			_ = db.Close(ctx)
 			err = fmt.Errorf("error on create table: %w", err)
 			return
 		}
+
+		s = newService(store, registry)
+		s.db = db
 	})
 	if err != nil {
 		once = sync.Once{}
@@ -186,128 +156,102 @@ func getService(ctx context.Context, dsn string, opts ...ydb.Option) (s *service
 	return s, nil
 }
 
-func (s *service) Close(ctx context.Context) {
-	defer func() { _ = s.db.Close(ctx) }()
+// newService creates service over store and registers its metrics in registry
+func newService(store LinkStore, registry *prometheus.Registry) *service {
+	s := &service{
+		store:    store,
+		registry: registry,
+		router:   mux.NewRouter(),
+
+		maxBodySize:   defaultMaxBodySize,
+		deniedDomains: domainList{},
+		apiKeys:       keySet{},
+		stripTracking: true,
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "app",
+			Name:      "rejections_total",
+			Help:      "Count of rejected links creation requests by reason",
+		}, []string{
+			"reason",
+		}),
+	}
+	registry.MustRegister(s.rejections)
+	s.router.Use(httpmetrics.New(registry, "app").Middleware)
+
+	s.router.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		registry, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+	))
+	s.router.HandleFunc("/healthz", s.handleHealthz).Methods(http.MethodGet)
+	s.router.HandleFunc("/readyz", s.handleReadyz).Methods(http.MethodGet)
+	s.router.HandleFunc("/", s.handleIndex).Methods(http.MethodGet)
+	s.router.HandleFunc("/shorten", s.handleShorten).Methods(http.MethodPost)
+	api := s.router.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/openapi.json", s.handleAPISpec).Methods(http.MethodGet)
+	api.HandleFunc("/links", s.handleAPICreateLink).Methods(http.MethodPost)
+	api.HandleFunc("/links", s.handleAPIListLinks).Methods(http.MethodGet)
+	api.HandleFunc("/links/{hash}", s.handleAPIGetLink).Methods(http.MethodGet)
+	api.HandleFunc("/links/{hash}", s.handleAPIDeleteLink).Methods(http.MethodDelete)
+	s.router.HandleFunc("/{hash:[a-zA-Z0-9_-]{4,32}}", s.handleLonger).Methods(http.MethodGet)
+	s.router.HandleFunc("/{hash:[a-zA-Z0-9_-]{4,32}}/stats", s.handleStats).Methods(http.MethodGet)
+
+	return s
 }
 
-func (s *service) createTable(ctx context.Context) (err error) {
-	query := render(
-		template.Must(template.New("").Parse(`
-			PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
-
-			CREATE TABLE urls (
-				src Text,
-				hash Text,
-
-				PRIMARY KEY (hash)
-			);
-		`)),
-		templateConfig{
-			TablePathPrefix: path.Join(s.db.Name(), prefix),
-		},
-	)
-	return s.db.Table().Do(ctx,
-		func(ctx context.Context, s table.Session) error {
-			err := s.ExecuteSchemeQuery(ctx, query)
-			return err
-		},
-	)
+func (s *service) Close(ctx context.Context) {
+	defer func() { _ = s.store.Close(ctx) }()
 }
 
-func (s *service) insertShort(ctx context.Context, url string) (h string, err error) {
-	h, err = hash(url)
+// selectLong returns url by hash, using links cache if it is enabled
+func (s *service) selectLong(ctx context.Context, hash string) (url string, err error) {
+	var link storedLink
+	if s.cache != nil {
+		link, err = s.cache.Load(hash, func() (storedLink, error) {
+			return s.store.SelectLink(ctx, hash)
+		})
+	} else {
+		link, err = s.store.SelectLink(ctx, hash)
+	}
 	if err != nil {
 		return "", err
 	}
-	query := render(
-		template.Must(template.New("").Parse(`
-			PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
-
-			DECLARE $hash as Text;
-			DECLARE $src as Text;
-
-			REPLACE INTO
-				urls (hash, src)
-			VALUES
-				($hash, $src);
-		`)),
-		templateConfig{
-			TablePathPrefix: path.Join(s.db.Name(), prefix),
-		},
-	)
-	writeTx := table.TxControl(
-		table.BeginTx(
-			table.WithSerializableReadWrite(),
-		),
-		table.CommitTx(),
-	)
-	err = s.db.Table().Do(ctx,
-		func(ctx context.Context, s table.Session) (err error) {
-			_, _, err = s.Execute(ctx, writeTx, query,
-				table.NewQueryParameters(
-					table.ValueParam("$hash", types.TextValue(h)),
-					table.ValueParam("$src", types.TextValue(url)),
-				),
-				options.WithCollectStatsModeBasic(),
-			)
-			return
-		},
-	)
-	return h, err
+	return link.src, nil
 }
 
-func (s *service) selectLong(ctx context.Context, hash string) (url string, err error) {
-	query := render(
-		template.Must(template.New("").Parse(`
-			PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
-
-			DECLARE $hash as Text;
-
-			SELECT
-				src
-			FROM
-				urls
-			WHERE
-				hash = $hash;
-		`)),
-		templateConfig{
-			TablePathPrefix: path.Join(s.db.Name(), prefix),
-		},
-	)
-	readTx := table.TxControl(
-		table.BeginTx(
-			table.WithSnapshotReadOnly(),
-		),
-		table.CommitTx(),
-	)
-	var res result.Result
-	err = s.db.Table().Do(ctx,
-		func(ctx context.Context, s table.Session) (err error) {
-			_, res, err = s.Execute(ctx, readTx, query,
-				table.NewQueryParameters(
-					table.ValueParam("$hash", types.TextValue(hash)),
-				),
-				options.WithCollectStatsModeBasic(),
-			)
-			return err
-		},
-	)
+// deleteLink removes link from store and from local cache, caches of other instances are
+// invalidated by changefeed
+func (s *service) deleteLink(ctx context.Context, hash string) error {
+	if err := s.store.DeleteLink(ctx, hash); err != nil {
+		return err
+	}
+	if s.cache != nil {
+		s.cache.Remove(hash)
+	}
+	return nil
+}
+
+// createLink validates link parameters, stores canonical form of url and returns stored link. Empty alias means
+// hash-based code, empty ttl means link never expires.
+func (s *service) createLink(ctx context.Context, url, alias, ttl string) (link storedLink, err error) {
+	u, err := canonicalURL(url, s.stripTracking)
 	if err != nil {
-		return "", err
+		return link, fmt.Errorf("%w: "+invalidURLError+" %v", errBadRequest, url, err)
+	}
+	if err = s.checkDomain(u.Hostname()); err != nil {
+		return link, err
 	}
-	defer func() {
-		_ = res.Close()
-	}()
-	var src string
-	for res.NextResultSet(ctx) {
-		for res.NextRow() {
-			err = res.ScanNamed(
-				named.OptionalWithDefault("src", &src),
-			)
-			return src, err
+	if alias != "" && !isAliasCorrect(alias) {
+		return link, fmt.Errorf("%w: "+invalidAlias, errBadRequest, alias)
+	}
+	var expiresAt *time.Time
+	if ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			return link, fmt.Errorf("%w: "+invalidTTL, errBadRequest, ttl)
 		}
+		t := time.Now().Add(d)
+		expiresAt = &t
 	}
-	return "", fmt.Errorf(hashNotFound, hash)
+	return s.store.InsertShort(ctx, u.String(), alias, expiresAt)
 }
 
 func writeResponse(w http.ResponseWriter, statusCode int, body string) {
@@ -315,34 +259,31 @@ func writeResponse(w http.ResponseWriter, statusCode int, body string) {
 	_, _ = w.Write([]byte(body))
 }
 
-func successToString(b bool) string {
-	if b {
-		return "true"
+// statusOf maps service error to http status code
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, errHashNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errAliasTaken):
+		return http.StatusConflict
+	case errors.Is(err, errDeniedDomain):
+		return http.StatusForbidden
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errRateLimited):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
 	}
-	return "false"
 }
 
 func (s *service) handleIndex(w http.ResponseWriter, r *http.Request) {
 	var (
-		err   error
-		tpl   *template.Template
-		start = time.Now()
+		err error
+		tpl *template.Template
 	)
-	defer func() {
-		if err != nil {
-			s.callsErrors.With(prometheus.Labels{
-				"method": "index",
-			}).Add(1)
-		}
-		s.callsLatency.With(prometheus.Labels{
-			"method":  "index",
-			"success": successToString(err == nil),
-		}).Observe(time.Since(start).Seconds())
-		s.calls.With(prometheus.Labels{
-			"method":  "index",
-			"success": successToString(err == nil),
-		}).Add(1)
-	}()
 	tpl, err = template.ParseFS(static, "static/index.html")
 	if err != nil {
 		writeResponse(w, http.StatusInternalServerError, err.Error())
@@ -361,77 +302,44 @@ func (s *service) handleIndex(w http.ResponseWriter, r *http.Request) {
 
 func (s *service) handleShorten(w http.ResponseWriter, r *http.Request) {
 	var (
-		err   error
-		url   []byte
-		hash  string
-		start = time.Now()
+		err  error
+		url  []byte
+		link storedLink
 	)
-	defer func() {
-		if err != nil {
-			s.callsErrors.With(prometheus.Labels{
-				"method": "shorten",
-			}).Add(1)
-		}
-		s.callsLatency.With(prometheus.Labels{
-			"method":  "shorten",
-			"success": successToString(err == nil),
-		}).Observe(time.Since(start).Seconds())
-		s.calls.With(prometheus.Labels{
-			"method":  "index",
-			"success": successToString(err == nil),
-		}).Add(1)
-	}()
-	url, err = io.ReadAll(r.Body)
+	url, err = s.readCreateRequest(r)
 	if err != nil {
-		writeResponse(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-	if !isLongCorrect(string(url)) {
-		err = fmt.Errorf(fmt.Sprintf(invalidURLError, url))
-		writeResponse(w, http.StatusBadRequest, err.Error())
+		setRetryAfter(w, err)
+		writeResponse(w, statusOf(err), err.Error())
 		return
 	}
-	hash, err = s.insertShort(r.Context(), string(url))
+	link, err = s.createLink(r.Context(), string(url), r.URL.Query().Get("alias"), r.URL.Query().Get("ttl"))
 	if err != nil {
-		writeResponse(w, http.StatusInternalServerError, err.Error())
+		writeResponse(w, statusOf(err), err.Error())
 		return
 	}
 	w.Header().Set("Content-Type", "application/text")
-	writeResponse(w, http.StatusOK, hash)
+	writeResponse(w, http.StatusOK, link.hash)
 }
 
 func (s *service) handleLonger(w http.ResponseWriter, r *http.Request) {
 	var (
-		err   error
-		url   string
-		start = time.Now()
+		err error
+		url string
 	)
-	defer func() {
-		if err != nil {
-			s.callsErrors.With(prometheus.Labels{
-				"method": "longer",
-			}).Add(1)
-		}
-		s.callsLatency.With(prometheus.Labels{
-			"method":  "longer",
-			"success": successToString(err == nil),
-		}).Observe(time.Since(start).Seconds())
-		s.calls.With(prometheus.Labels{
-			"method":  "index",
-			"success": successToString(err == nil),
-		}).Add(1)
-	}()
 	path := strings.Split(r.URL.Path, "/")
-	if !isShortCorrect(path[len(path)-1]) {
+	if !isShortCorrect(path[len(path)-1]) && !isAliasCorrect(path[len(path)-1]) {
 		err = fmt.Errorf(fmt.Sprintf(invalidHashError, path[len(path)-1]))
 		writeResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	url, err = s.selectLong(r.Context(), path[len(path)-1])
 	if err != nil {
-		writeResponse(w, http.StatusInternalServerError, err.Error())
+		writeResponse(w, statusOf(err), err.Error())
 		return
 	}
+	if clickErr := s.store.InsertClick(r.Context(), path[len(path)-1], r.Referer(), r.UserAgent()); clickErr != nil {
+		log.Warn().Err(clickErr).Str("hash", path[len(path)-1]).Msg("insert click failed")
+	}
 	http.Redirect(w, r, url, http.StatusSeeOther)
 }
 
@@ -448,5 +356,15 @@ func Serverless(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer s.Close(r.Context())
+	protectOnce.Do(func() {
+		var p protection
+		if p, protectErr = envProtection(); protectErr == nil {
+			s.protect(p)
+		}
+	})
+	if protectErr != nil {
+		writeResponse(w, http.StatusInternalServerError, protectErr.Error())
+		return
+	}
 	s.router.ServeHTTP(w, r)
 }
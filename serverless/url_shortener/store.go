@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// LinkStore is a storage of links and their clicks
+type LinkStore interface {
+	// InsertShort stores url and returns stored link with its short code and expiration time, which is later
+	// than expiresAt if url is already stored under the code with later expiration.
+	// If alias is not empty it is used as a short code, otherwise the code is derived from url hash.
+	// Colliding urls never overwrite each other. Nil expiresAt means that link never expires.
+	InsertShort(ctx context.Context, url string, alias string, expiresAt *time.Time) (storedLink, error)
+	// SelectLink returns not expired link by hash
+	SelectLink(ctx context.Context, hash string) (storedLink, error)
+	// ListLinks returns up to limit not expired links with hash greater than after, ordered by hash
+	ListLinks(ctx context.Context, after string, limit int) ([]storedLink, error)
+	// DeleteLink removes link and its clicks by hash
+	DeleteLink(ctx context.Context, hash string) error
+	// InsertClick records a click event of redirect by hash
+	InsertClick(ctx context.Context, hash, referrer, userAgent string) error
+	// SelectStats returns total and per-day counts of clicks by hash
+	SelectStats(ctx context.Context, hash string) (linkStats, error)
+	// Ping checks that store is available
+	Ping(ctx context.Context) error
+	// Close releases store resources
+	Close(ctx context.Context) error
+}
+
+// dayStats is a count of clicks per one day
+type dayStats struct {
+	Day    string `json:"day"`
+	Clicks uint64 `json:"clicks"`
+}
+
+// linkStats is a response of stats endpoint
+type linkStats struct {
+	Hash  string     `json:"hash"`
+	Total uint64     `json:"total"`
+	Days  []dayStats `json:"days"`
+}
+
+// storedLink is a stored short link
+type storedLink struct {
+	hash      string
+	src       string
+	expiresAt *time.Time
+}
+
+func (l storedLink) isExpired(now time.Time) bool {
+	return l.expiresAt != nil && !now.Before(*l.expiresAt)
+}
+
+// isNewLink reports whether link is written under hash h instead of missing or expired one, so previous clicks
+// of hash don't belong to it
+func isNewLink(stored map[string]storedLink, h string, now time.Time) bool {
+	link, exists := stored[h]
+	return !exists || link.isExpired(now)
+}
+
+// laterExpiry returns the latest of two expiration times, nil means link never expires
+func laterExpiry(a, b *time.Time) *time.Time {
+	if a == nil || b == nil {
+		return nil
+	}
+	if a.After(*b) {
+		return a
+	}
+	return b
+}
+
+// shortCandidates returns the codes which are tried in order for the url.
+// Alias is the only candidate if it is not empty. Otherwise first candidate is a plain hash of url,
+// next ones are hashes of salted url.
+func shortCandidates(url string, alias string) (candidates []string, err error) {
+	if alias != "" {
+		return []string{alias}, nil
+	}
+	candidates = make([]string, 0, maxShortAttempts)
+	for i := 0; i < maxShortAttempts; i++ {
+		salted := url
+		if i > 0 {
+			salted = url + "#" + strconv.Itoa(i)
+		}
+		h, err := hash(salted)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, h)
+	}
+	return candidates, nil
+}
+
+// pickShort chooses the first candidate which is free, expired or already points to url.
+// It also returns expiration time which link must be written with, write is false if stored link
+// already satisfies requested expiresAt.
+func pickShort(
+	candidates []string, stored map[string]storedLink, url string, isAlias bool, expiresAt *time.Time, now time.Time,
+) (h string, newExpiresAt *time.Time, write bool, err error) {
+	for _, c := range candidates {
+		link, exists := stored[c]
+		if !exists || link.isExpired(now) {
+			return c, expiresAt, true, nil
+		}
+		if link.src == url {
+			// url is already stored under this code, only prolong it if needed
+			newExpiresAt = laterExpiry(link.expiresAt, expiresAt)
+			return c, newExpiresAt, newExpiresAt != link.expiresAt, nil
+		}
+	}
+	if isAlias {
+		return "", nil, false, fmt.Errorf("%w: '%s'", errAliasTaken, candidates[0])
+	}
+	return "", nil, false, fmt.Errorf("%w: '%s'", errNoFreeShort, url)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryClick is a click event stored in memory
+type memoryClick struct {
+	hash string
+	ts   time.Time
+}
+
+// memoryStore is a LinkStore which keeps links in process memory.
+// It is used in tests and for local runs without YDB.
+type memoryStore struct {
+	m      sync.Mutex
+	links  map[string]storedLink
+	clicks []memoryClick
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		links: make(map[string]storedLink),
+	}
+}
+
+func (st *memoryStore) Close(context.Context) error {
+	return nil
+}
+
+func (st *memoryStore) Ping(context.Context) error {
+	return nil
+}
+
+func (st *memoryStore) InsertShort(
+	_ context.Context, url string, alias string, expiresAt *time.Time,
+) (storedLink, error) {
+	candidates, err := shortCandidates(url, alias)
+	if err != nil {
+		return storedLink{}, err
+	}
+
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	now := time.Now()
+	h, newExpiresAt, write, err := pickShort(candidates, st.links, url, alias != "", expiresAt, now)
+	if err != nil {
+		return storedLink{}, err
+	}
+	if isNewLink(st.links, h, now) {
+		st.deleteClicks(h)
+	}
+	link := storedLink{
+		hash:      h,
+		src:       url,
+		expiresAt: newExpiresAt,
+	}
+	if write {
+		st.links[h] = link
+	}
+	return link, nil
+}
+
+func (st *memoryStore) SelectLink(_ context.Context, hash string) (storedLink, error) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	link, ok := st.links[hash]
+	if !ok || link.isExpired(time.Now()) {
+		return storedLink{}, fmt.Errorf("%w: '%s'", errHashNotFound, hash)
+	}
+	return link, nil
+}
+
+func (st *memoryStore) ListLinks(_ context.Context, after string, limit int) (links []storedLink, _ error) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	now := time.Now()
+	for h, link := range st.links {
+		if h > after && !link.isExpired(now) {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].hash < links[j].hash
+	})
+	if len(links) > limit {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+func (st *memoryStore) DeleteLink(_ context.Context, hash string) error {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	if _, ok := st.links[hash]; !ok {
+		return fmt.Errorf("%w: '%s'", errHashNotFound, hash)
+	}
+	delete(st.links, hash)
+	st.deleteClicks(hash)
+	return nil
+}
+
+func (st *memoryStore) deleteClicks(hash string) {
+	clicks := st.clicks[:0]
+	for _, c := range st.clicks {
+		if c.hash != hash {
+			clicks = append(clicks, c)
+		}
+	}
+	st.clicks = clicks
+}
+
+func (st *memoryStore) InsertClick(_ context.Context, hash, _, _ string) error {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	st.clicks = append(st.clicks, memoryClick{
+		hash: hash,
+		ts:   time.Now().UTC(),
+	})
+	return nil
+}
+
+func (st *memoryStore) SelectStats(_ context.Context, hash string) (linkStats, error) {
+	st.m.Lock()
+	defer st.m.Unlock()
+
+	stats := linkStats{
+		Hash: hash,
+		Days: make([]dayStats, 0),
+	}
+	for _, c := range st.clicks {
+		if c.hash != hash {
+			continue
+		}
+		day := c.ts.Format("2006-01-02")
+		if n := len(stats.Days); n == 0 || stats.Days[n-1].Day != day {
+			stats.Days = append(stats.Days, dayStats{Day: day})
+		}
+		stats.Days[len(stats.Days)-1].Clicks++
+		stats.Total++
+	}
+	return stats, nil
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+
+	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/sugar"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+// ydbStore is a LinkStore over YDB tables
+type ydbStore struct {
+	db      ydb.Connection
+	queries sync.Map
+}
+
+// newYDBStore creates tables of store if needed
+func newYDBStore(ctx context.Context, db ydb.Connection) (*ydbStore, error) {
+	st := &ydbStore{
+		db: db,
+	}
+	if err := st.createTables(ctx); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (st *ydbStore) Close(ctx context.Context) error {
+	return st.db.Close(ctx)
+}
+
+// Ping checks connection to database with discovery WhoAmI call
+func (st *ydbStore) Ping(ctx context.Context) error {
+	_, err := st.db.Discovery().WhoAmI(ctx)
+	return err
+}
+
+func render(t *template.Template, data interface{}) string {
+	var buf bytes.Buffer
+	err := t.Execute(&buf, data)
+	if err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+type templateConfig struct {
+	TablePathPrefix string
+}
+
+// query renders query template with tables prefix. Rendered queries are cached by template text.
+func (st *ydbStore) query(text string) string {
+	if q, ok := st.queries.Load(text); ok {
+		return q.(string)
+	}
+	q := render(
+		template.Must(template.New("").Parse(text)),
+		templateConfig{
+			TablePathPrefix: path.Join(st.db.Name(), prefix),
+		},
+	)
+	st.queries.Store(text, q)
+	return q
+}
+
+func expiryValue(expiresAt *time.Time) types.Value {
+	if expiresAt == nil {
+		return types.NullValue(types.TypeTimestamp)
+	}
+	return types.OptionalValue(types.TimestampValueFromTime(*expiresAt))
+}
+
+// createTables creates tables which don't exist and upgrades urls table which was created before links expiry
+func (st *ydbStore) createTables(ctx context.Context) (err error) {
+	for _, t := range []struct {
+		name    string
+		query   string
+		upgrade func(ctx context.Context, tablePath string) error
+	}{
+		{
+			name: "urls",
+			query: `
+				PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+				CREATE TABLE urls (
+					src Text,
+					hash Text,
+					expires_at Timestamp,
+
+					PRIMARY KEY (hash)
+				) WITH (
+					TTL = Interval("PT0S") ON expires_at
+				);
+			`,
+			upgrade: st.addExpiry,
+		},
+		{
+			name: "clicks",
+			query: `
+				PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+				CREATE TABLE clicks (
+					hash Text,
+					ts Timestamp,
+					id Text,
+					referrer Text,
+					user_agent Text,
+
+					PRIMARY KEY (hash, ts, id)
+				);
+			`,
+		},
+	} {
+		tablePath := path.Join(st.db.Name(), prefix, t.name)
+		exists, err := sugar.IsTableExists(ctx, st.db.Scheme(), tablePath)
+		if err != nil {
+			return err
+		}
+		if exists && t.upgrade != nil {
+			err = t.upgrade(ctx, tablePath)
+		}
+		if !exists {
+			query := st.query(t.query)
+			err = st.db.Table().Do(ctx,
+				func(ctx context.Context, s table.Session) error {
+					return s.ExecuteSchemeQuery(ctx, query)
+				},
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("create table '%s' failed: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// addExpiry adds expires_at column and TTL on it to urls table if they are missing
+func (st *ydbStore) addExpiry(ctx context.Context, tablePath string) error {
+	return st.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) error {
+			description, err := s.DescribeTable(ctx, tablePath)
+			if err != nil {
+				return err
+			}
+			exists := false
+			for _, c := range description.Columns {
+				exists = exists || c.Name == "expires_at"
+			}
+			if !exists {
+				err = s.AlterTable(ctx, tablePath,
+					options.WithAddColumn("expires_at", types.Optional(types.TypeTimestamp)),
+				)
+				if err != nil {
+					return err
+				}
+			}
+			if description.TimeToLiveSettings != nil {
+				return nil
+			}
+			// TTL is set by separate alter, because column must exist before
+			return s.AlterTable(ctx, tablePath, options.WithSetTimeToLiveSettings(
+				options.NewTTLSettings().ColumnDateType("expires_at").ExpireAfter(0),
+			))
+		},
+	)
+}
+
+// InsertShort checks stored src inside serializable transaction
+func (st *ydbStore) InsertShort(
+	ctx context.Context, url string, alias string, expiresAt *time.Time,
+) (link storedLink, err error) {
+	candidates, err := shortCandidates(url, alias)
+	if err != nil {
+		return link, err
+	}
+	hashes := make([]types.Value, 0, len(candidates))
+	for _, c := range candidates {
+		hashes = append(hashes, types.TextValue(c))
+	}
+	selectQuery := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hashes as List<Text>;
+
+		SELECT
+			hash, src, expires_at
+		FROM
+			urls
+		WHERE
+			hash IN $hashes;
+	`)
+	upsertQuery := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hash as Text;
+		DECLARE $src as Text;
+		DECLARE $expires_at as Optional<Timestamp>;
+
+		UPSERT INTO
+			urls (hash, src, expires_at)
+		VALUES
+			($hash, $src, $expires_at);
+	`)
+	clearClicksQuery := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hash as Text;
+
+		DELETE FROM
+			clicks
+		WHERE
+			hash = $hash;
+	`)
+	err = st.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			res, err := tx.Execute(ctx, selectQuery,
+				table.NewQueryParameters(
+					table.ValueParam("$hashes", types.ListValue(hashes...)),
+				),
+				options.WithCollectStatsModeBasic(),
+			)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = res.Close()
+			}()
+			stored := make(map[string]storedLink, len(candidates))
+			for res.NextResultSet(ctx) {
+				for res.NextRow() {
+					var link storedLink
+					err = res.ScanNamed(
+						named.OptionalWithDefault("hash", &link.hash),
+						named.OptionalWithDefault("src", &link.src),
+						named.Optional("expires_at", &link.expiresAt),
+					)
+					if err != nil {
+						return err
+					}
+					stored[link.hash] = link
+				}
+			}
+			if err = res.Err(); err != nil {
+				return err
+			}
+			var (
+				h            string
+				newExpiresAt *time.Time
+				write        bool
+			)
+			now := time.Now()
+			h, newExpiresAt, write, err = pickShort(candidates, stored, url, alias != "", expiresAt, now)
+			if err != nil {
+				return err
+			}
+			link = storedLink{
+				hash:      h,
+				src:       url,
+				expiresAt: newExpiresAt,
+			}
+			if !write {
+				return nil
+			}
+			if isNewLink(stored, h, now) {
+				// clicks of expired link or of link removed by TTL don't belong to new link
+				_, err = tx.Execute(ctx, clearClicksQuery,
+					table.NewQueryParameters(
+						table.ValueParam("$hash", types.TextValue(h)),
+					),
+				)
+				if err != nil {
+					return err
+				}
+			}
+			_, err = tx.Execute(ctx, upsertQuery,
+				table.NewQueryParameters(
+					table.ValueParam("$hash", types.TextValue(h)),
+					table.ValueParam("$src", types.TextValue(url)),
+					table.ValueParam("$expires_at", expiryValue(newExpiresAt)),
+				),
+				options.WithCollectStatsModeBasic(),
+			)
+			return err
+		},
+		table.WithTxSettings(
+			table.TxSettings(
+				table.WithSerializableReadWrite(),
+			),
+		),
+	)
+	if err != nil {
+		return storedLink{}, err
+	}
+	return link, nil
+}
+
+func (st *ydbStore) SelectLink(ctx context.Context, hash string) (link storedLink, err error) {
+	query := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hash as Text;
+
+		SELECT
+			src, expires_at
+		FROM
+			urls
+		WHERE
+			hash = $hash;
+	`)
+	readTx := table.TxControl(
+		table.BeginTx(
+			table.WithSnapshotReadOnly(),
+		),
+		table.CommitTx(),
+	)
+	var res result.Result
+	err = st.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			_, res, err = s.Execute(ctx, readTx, query,
+				table.NewQueryParameters(
+					table.ValueParam("$hash", types.TextValue(hash)),
+				),
+				options.WithCollectStatsModeBasic(),
+			)
+			return err
+		},
+	)
+	if err != nil {
+		return link, err
+	}
+	defer func() {
+		_ = res.Close()
+	}()
+	link.hash = hash
+	for res.NextResultSet(ctx) {
+		for res.NextRow() {
+			err = res.ScanNamed(
+				named.OptionalWithDefault("src", &link.src),
+				named.Optional("expires_at", &link.expiresAt),
+			)
+			if err != nil {
+				return link, err
+			}
+			// expired rows are removed by TTL asynchronously
+			if link.isExpired(time.Now()) {
+				return storedLink{}, fmt.Errorf("%w: '%s'", errHashNotFound, hash)
+			}
+			return link, nil
+		}
+	}
+	return storedLink{}, fmt.Errorf("%w: '%s'", errHashNotFound, hash)
+}
+
+func (st *ydbStore) ListLinks(ctx context.Context, after string, limit int) (links []storedLink, err error) {
+	query := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $after as Text;
+		DECLARE $limit as Uint64;
+
+		SELECT
+			hash, src, expires_at
+		FROM
+			urls
+		WHERE
+			hash > $after AND (expires_at IS NULL OR expires_at > CurrentUtcTimestamp())
+		ORDER BY
+			hash
+		LIMIT
+			$limit;
+	`)
+	readTx := table.TxControl(
+		table.BeginTx(
+			table.WithSnapshotReadOnly(),
+		),
+		table.CommitTx(),
+	)
+	var res result.Result
+	err = st.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			_, res, err = s.Execute(ctx, readTx, query,
+				table.NewQueryParameters(
+					table.ValueParam("$after", types.TextValue(after)),
+					table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+				),
+				options.WithCollectStatsModeBasic(),
+			)
+			return err
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = res.Close()
+	}()
+	for res.NextResultSet(ctx) {
+		for res.NextRow() {
+			var link storedLink
+			err = res.ScanNamed(
+				named.OptionalWithDefault("hash", &link.hash),
+				named.OptionalWithDefault("src", &link.src),
+				named.Optional("expires_at", &link.expiresAt),
+			)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, link)
+		}
+	}
+	return links, res.Err()
+}
+
+func (st *ydbStore) DeleteLink(ctx context.Context, hash string) (err error) {
+	selectQuery := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hash as Text;
+
+		SELECT
+			hash
+		FROM
+			urls
+		WHERE
+			hash = $hash;
+	`)
+	deleteQuery := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hash as Text;
+
+		DELETE FROM
+			urls
+		WHERE
+			hash = $hash;
+
+		DELETE FROM
+			clicks
+		WHERE
+			hash = $hash;
+	`)
+	params := table.NewQueryParameters(
+		table.ValueParam("$hash", types.TextValue(hash)),
+	)
+	return st.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) (err error) {
+			res, err := tx.Execute(ctx, selectQuery, params)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = res.Close()
+			}()
+			if !res.NextResultSet(ctx) || !res.HasNextRow() {
+				return fmt.Errorf("%w: '%s'", errHashNotFound, hash)
+			}
+			_, err = tx.Execute(ctx, deleteQuery, params)
+			return err
+		},
+		table.WithTxSettings(
+			table.TxSettings(
+				table.WithSerializableReadWrite(),
+			),
+		),
+	)
+}
+
+func (st *ydbStore) InsertClick(ctx context.Context, hash, referrer, userAgent string) error {
+	query := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hash as Text;
+		DECLARE $ts as Timestamp;
+		DECLARE $id as Text;
+		DECLARE $referrer as Text;
+		DECLARE $user_agent as Text;
+
+		UPSERT INTO
+			clicks (hash, ts, id, referrer, user_agent)
+		VALUES
+			($hash, $ts, $id, $referrer, $user_agent);
+	`)
+	writeTx := table.TxControl(
+		table.BeginTx(
+			table.WithSerializableReadWrite(),
+		),
+		table.CommitTx(),
+	)
+	params := table.NewQueryParameters(
+		table.ValueParam("$hash", types.TextValue(hash)),
+		table.ValueParam("$ts", types.TimestampValueFromTime(time.Now())),
+		table.ValueParam("$id", types.TextValue(uuid.NewString())),
+		table.ValueParam("$referrer", types.TextValue(referrer)),
+		table.ValueParam("$user_agent", types.TextValue(userAgent)),
+	)
+	return st.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			_, _, err = s.Execute(ctx, writeTx, query, params,
+				options.WithCollectStatsModeBasic(),
+			)
+			return err
+		},
+		table.WithIdempotent(),
+	)
+}
+
+func (st *ydbStore) SelectStats(ctx context.Context, hash string) (stats linkStats, err error) {
+	query := st.query(`
+		PRAGMA TablePathPrefix("{{ .TablePathPrefix }}");
+
+		DECLARE $hash as Text;
+
+		SELECT
+			day, COUNT(*) AS clicks
+		FROM
+			clicks
+		WHERE
+			hash = $hash
+		GROUP BY
+			CAST(ts AS Date) AS day
+		ORDER BY
+			day;
+	`)
+	readTx := table.TxControl(
+		table.BeginTx(
+			table.WithSnapshotReadOnly(),
+		),
+		table.CommitTx(),
+	)
+	var res result.Result
+	err = st.db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			_, res, err = s.Execute(ctx, readTx, query,
+				table.NewQueryParameters(
+					table.ValueParam("$hash", types.TextValue(hash)),
+				),
+				options.WithCollectStatsModeBasic(),
+			)
+			return err
+		},
+	)
+	if err != nil {
+		return stats, err
+	}
+	defer func() {
+		_ = res.Close()
+	}()
+	stats = linkStats{
+		Hash: hash,
+		Days: make([]dayStats, 0),
+	}
+	for res.NextResultSet(ctx) {
+		for res.NextRow() {
+			var (
+				day    time.Time
+				clicks uint64
+			)
+			err = res.ScanNamed(
+				named.OptionalWithDefault("day", &day),
+				named.Required("clicks", &clicks),
+			)
+			if err != nil {
+				return stats, err
+			}
+			stats.Total += clicks
+			stats.Days = append(stats.Days, dayStats{
+				Day:    day.Format("2006-01-02"),
+				Clicks: clicks,
+			})
+		}
+	}
+	return stats, res.Err()
+}
@@ -5,9 +5,10 @@ import (
 	"sync/atomic"
 )
 
+// balancer round-robins requests over in-process handlers
 type balancer struct {
 	handlers []http.Handler
-	counter  int32
+	counter  uint32
 }
 
 func newBalancer(handlers ...http.Handler) *balancer {
@@ -17,10 +18,7 @@ func newBalancer(handlers ...http.Handler) *balancer {
 }
 
 func (b *balancer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	counter := atomic.AddInt32(&b.counter, 1)
-	if counter < 0 {
-		counter = -counter
-	}
-	index := int(counter-1) % len(b.handlers)
+	counter := atomic.AddUint32(&b.counter, 1)
+	index := int((counter - 1) % uint32(len(b.handlers)))
 	b.handlers[index].ServeHTTP(writer, request)
 }
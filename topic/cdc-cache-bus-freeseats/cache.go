@@ -1,89 +1,165 @@
 package main
 
 import (
+	"container/list"
 	"sync"
 	"time"
 )
 
-type Cache struct {
-	timeout time.Duration
+// Cache is a cache of free seats by bus id
+type Cache interface {
+	// Get returns cached value. Value is not fresh when its timeout is expired, but it may be served
+	// while it is refreshed.
+	Get(key string) (value int64, fresh bool, ok bool)
+	Set(key string, value int64)
+	Delete(key string)
+	// Clear removes all entries
+	Clear()
+	Stats() CacheStats
+}
 
-	m          sync.Mutex
-	setCounter int
-	values     map[string]CacheItem
+// CacheStats is a cache usage statistics
+type CacheStats struct {
+	Hits        uint64
+	StaleHits   uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+	Len         int
 }
 
-func NewCache(timeout time.Duration) *Cache {
-	return &Cache{
-		timeout: timeout,
-		values:  make(map[string]CacheItem),
+// NewCache returns LRU cache or disabled cache for zero timeout
+func NewCache(size int, timeout, staleTimeout time.Duration) Cache {
+	if timeout == 0 || size <= 0 {
+		return disabledCache{}
 	}
+	return NewLRUCache(size, timeout, staleTimeout)
+}
+
+// disabledCache never holds values
+type disabledCache struct{}
+
+func (disabledCache) Get(string) (int64, bool, bool) { return 0, false, false }
+
+func (disabledCache) Set(string, int64) {}
+
+func (disabledCache) Delete(string) {}
+
+func (disabledCache) Clear() {}
+
+func (disabledCache) Stats() CacheStats { return CacheStats{} }
+
+// LRUCache is a cache bounded by count of entries, the least recently used entry is evicted on overflow.
+// Entry is fresh for timeout after set and stale for staleTimeout after that.
+type LRUCache struct {
+	size         int
+	timeout      time.Duration
+	staleTimeout time.Duration
+	now          func() time.Time
+
+	m      sync.Mutex
+	values map[string]*list.Element
+	order  *list.List // front is the most recently used
+	stats  CacheStats
 }
 
-func (c *Cache) Get(key string) (int64, bool) {
-	if c.timeout == 0 {
-		return 0, false
+type CacheItem struct {
+	Key       string
+	ExpiresAt time.Time
+	Value     int64
+}
+
+func NewLRUCache(size int, timeout, staleTimeout time.Duration) *LRUCache {
+	return &LRUCache{
+		size:         size,
+		timeout:      timeout,
+		staleTimeout: staleTimeout,
+		now:          time.Now,
+		values:       make(map[string]*list.Element, size),
+		order:        list.New(),
 	}
+}
+
+func (c *LRUCache) Get(key string) (value int64, fresh bool, ok bool) {
+	now := c.now()
 
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	item, ok := c.values[key]
+	e, ok := c.values[key]
 	if !ok {
-		return 0, false
+		c.stats.Misses++
+		return 0, false, false
 	}
 
-	if time.Now().After(item.ExpiresAt) {
-		delete(c.values, key)
-		return 0, false
+	item := e.Value.(*CacheItem)
+	switch {
+	case now.Before(item.ExpiresAt):
+		c.stats.Hits++
+		fresh = true
+	case now.Before(item.ExpiresAt.Add(c.staleTimeout)):
+		c.stats.StaleHits++
+	default:
+		c.removeNeedLock(e)
+		c.stats.Expirations++
+		c.stats.Misses++
+		return 0, false, false
 	}
-
-	return item.Value, true
+	c.order.MoveToFront(e)
+	return item.Value, fresh, true
 }
 
-func (c *Cache) Set(key string, value int64) {
-	if c.timeout == 0 {
-		return
-	}
+func (c *LRUCache) Set(key string, value int64) {
+	expiresAt := c.now().Add(c.timeout)
 
-	c.set(time.Now(), key, value)
-}
+	c.m.Lock()
+	defer c.m.Unlock()
 
-func (c *Cache) Delete(key string) {
-	if c.timeout == 0 {
+	if e, ok := c.values[key]; ok {
+		item := e.Value.(*CacheItem)
+		item.Value, item.ExpiresAt = value, expiresAt
+		c.order.MoveToFront(e)
 		return
 	}
 
+	c.values[key] = c.order.PushFront(&CacheItem{
+		Key:       key,
+		ExpiresAt: expiresAt,
+		Value:     value,
+	})
+	for c.order.Len() > c.size {
+		c.removeNeedLock(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	delete(c.values, key)
+	if e, ok := c.values[key]; ok {
+		c.removeNeedLock(e)
+	}
 }
 
-func (c *Cache) set(now time.Time, key string, value int64) {
+func (c *LRUCache) Clear() {
 	c.m.Lock()
 	defer c.m.Unlock()
 
-	c.setCounter++
-	if c.setCounter%1000 == 0 {
-		c.cleanupNeedLock(now)
-	}
-
-	c.values[key] = CacheItem{
-		Value:     value,
-		ExpiresAt: now.Add(c.timeout),
-	}
+	c.values = make(map[string]*list.Element, c.size)
+	c.order.Init()
 }
 
-func (c *Cache) cleanupNeedLock(now time.Time) {
-	for key, item := range c.values {
-		if now.After(item.ExpiresAt) {
-			delete(c.values, key)
-		}
-	}
+func (c *LRUCache) Stats() CacheStats {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	stats := c.stats
+	stats.Len = c.order.Len()
+	return stats
 }
 
-type CacheItem struct {
-	ExpiresAt time.Time
-	Value     int64
+func (c *LRUCache) removeNeedLock(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.values, e.Value.(*CacheItem).Key)
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cacheCollector exports cache statistics of backend servers as prometheus metrics
+type cacheCollector struct {
+	caches map[int]Cache
+
+	hits        *prometheus.Desc
+	staleHits   *prometheus.Desc
+	misses      *prometheus.Desc
+	evictions   *prometheus.Desc
+	expirations *prometheus.Desc
+	entries     *prometheus.Desc
+}
+
+func newCacheCollector(namespace string, caches map[int]Cache) *cacheCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "cache", name), help, []string{"server"}, nil)
+	}
+	return &cacheCollector{
+		caches:      caches,
+		hits:        desc("hits_total", "count of cache hits with fresh value"),
+		staleHits:   desc("stale_hits_total", "count of cache hits with stale value which is served while refreshed"),
+		misses:      desc("misses_total", "count of cache misses"),
+		evictions:   desc("evictions_total", "count of entries evicted on cache overflow"),
+		expirations: desc("expirations_total", "count of entries removed after stale timeout"),
+		entries:     desc("entries", "count of entries in cache"),
+	}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.staleHits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.expirations
+	ch <- c.entries
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for id, cache := range c.caches {
+		server := strconv.Itoa(id)
+		stats := cache.Stats()
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stats.Hits), server)
+		ch <- prometheus.MustNewConstMetric(c.staleHits, prometheus.CounterValue, float64(stats.StaleHits), server)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stats.Misses), server)
+		ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(stats.Evictions), server)
+		ch <- prometheus.MustNewConstMetric(c.expirations, prometheus.CounterValue, float64(stats.Expirations), server)
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(stats.Len), server)
+	}
+}
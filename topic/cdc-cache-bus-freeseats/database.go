@@ -9,13 +9,16 @@ import (
 	"time"
 
 	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/sugar"
 	"github.com/ydb-platform/ydb-go-sdk/v3/table"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topictypes"
 )
 
-func createTableAndCDC(ctx context.Context, db ydb.Connection, consumersCount int) {
-	err := createTables(ctx, db)
+// createTableAndCDC creates tables, changefeed and consumers which are missing, existing ones are dropped and
+// created again if recreate is true
+func createTableAndCDC(ctx context.Context, db ydb.Connection, consumersCount int, recreate bool) {
+	err := createTables(ctx, db, recreate)
 	if err != nil {
 		log.Fatalf("failed to create tables: %+v", err)
 	}
@@ -24,21 +27,37 @@ func createTableAndCDC(ctx context.Context, db ydb.Connection, consumersCount in
 	if err != nil {
 		log.Fatalf("failed to create consumers: %+v", err)
 	}
+
+	if *dlqTopic != "" {
+		err = createDeadLetterTopic(ctx, db, *dlqTopic)
+		if err != nil {
+			log.Fatalf("failed to create dead-letter topic: %+v", err)
+		}
+	}
 }
 
-func createTables(ctx context.Context, db ydb.Connection) error {
-	err := db.Table().Do(ctx, func(ctx context.Context, s table.Session) error {
-		err := s.DropTable(ctx, path.Join(db.Name(), "bus"))
-		if ydb.IsOperationErrorSchemeError(err) {
-			err = nil
+func createTables(ctx context.Context, db ydb.Connection, recreate bool) error {
+	if recreate {
+		for _, name := range []string{"bus", "purchases"} {
+			err := db.Table().Do(ctx, func(ctx context.Context, s table.Session) error {
+				err := s.DropTable(ctx, path.Join(db.Name(), name))
+				if ydb.IsOperationErrorSchemeError(err) {
+					err = nil
+				}
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to drop table: %w", err)
+			}
 		}
-		return err
-	})
-	if err != nil {
-		return fmt.Errorf("failed to drop table: %w", err)
 	}
 
-	_, err = db.Scripting().Execute(ctx, `
+	exists, err := sugar.IsTableExists(ctx, db.Scheme(), path.Join(db.Name(), "bus"))
+	if err != nil {
+		return fmt.Errorf("failed to check table: %w", err)
+	}
+	if !exists {
+		_, err = db.Scripting().Execute(ctx, `
 CREATE TABLE bus (id Text, freeSeats Int64, PRIMARY KEY(id));
 
 ALTER TABLE 
@@ -50,21 +69,47 @@ WITH (
 	MODE = 'UPDATES'
 )
 `, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
-	}
-	_, err = db.Scripting().Execute(ctx, `
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
+		_, err = db.Scripting().Execute(ctx, `
 UPSERT INTO bus (id, freeSeats) VALUES ("bus1", 40), ("bus2", 60);
 `, nil)
+		if err != nil {
+			return fmt.Errorf("failed insert rows: %w", err)
+		}
+	}
+
+	exists, err = sugar.IsTableExists(ctx, db.Scheme(), path.Join(db.Name(), "purchases"))
 	if err != nil {
-		return fmt.Errorf("failed insert rows: %w", err)
+		return fmt.Errorf("failed to check table: %w", err)
+	}
+	if !exists {
+		_, err = db.Scripting().Execute(ctx, `
+CREATE TABLE purchases (id Text, busId Text, freeSeats Int64, cancelled Bool, PRIMARY KEY(id));
+`, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create table: %w", err)
+		}
 	}
 	return nil
 }
 
+// createCosumers adds missing consumers of backends to changefeed
 func createCosumers(ctx context.Context, db ydb.Connection, consumersCount int) error {
+	description, err := db.Topic().Describe(ctx, "bus/updates")
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(description.Consumers))
+	for _, c := range description.Consumers {
+		existing[c.Name] = true
+	}
 	for i := 0; i < consumersCount; i++ {
-		err := db.Topic().Alter(ctx, "bus/updates", topicoptions.AlterWithAddConsumers(topictypes.Consumer{
+		if existing[consumerName(i)] {
+			continue
+		}
+		err = db.Topic().Alter(ctx, "bus/updates", topicoptions.AlterWithAddConsumers(topictypes.Consumer{
 			Name: consumerName(i),
 		}))
 		if err != nil {
@@ -75,6 +120,15 @@ func createCosumers(ctx context.Context, db ydb.Connection, consumersCount int)
 	return nil
 }
 
+// createDeadLetterTopic creates topic for broken cdc events if it doesn't exist, its letters are read by
+// redrive consumer
+func createDeadLetterTopic(ctx context.Context, db ydb.Connection, topicPath string) error {
+	if _, err := db.Topic().Describe(ctx, topicPath); err == nil {
+		return nil
+	}
+	return db.Topic().Create(ctx, topicPath, topicoptions.CreateWithConsumer(topictypes.Consumer{Name: "redrive"}))
+}
+
 func connect() ydb.Connection {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 	defer cancel()
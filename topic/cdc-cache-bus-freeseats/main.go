@@ -4,47 +4,124 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/dlq"
+	"github.com/ydb-platform/ydb-go-examples/internal/httpmetrics"
 )
 
-const defaultConnectionString = "grpc://localhost:2136/local"
+const (
+	defaultConnectionString = "grpc://localhost:2136/local"
+
+	modeAll      = "all"
+	modeBackend  = "backend"
+	modeBalancer = "balancer"
+)
 
 var (
+	mode = flag.String("mode", modeAll, "all - balancer and backend-count backends in one process, "+
+		"backend - one backend with backend-id, balancer - http proxy to backends")
 	host                = flag.String("listen-host", "localhost", "host/ip for start listener")
 	port                = flag.Int("port", 3619, "port to listen")
 	cacheTimeout        = flag.Duration("cache", time.Second*10, "cache timeout, 0 mean disable cache")
+	cacheStale          = flag.Duration("cache-stale", time.Second*5, "time after cache timeout while stale value is served and refreshed in background")
+	cacheSize           = flag.Int("cache-size", 10000, "max count of cached entries per server")
 	disableCDC          = flag.Bool("disable-cdc", false, "disable cdc")
-	skipCreateTable     = flag.Bool("skip-init", false, "skip recreate table and topic")
+	skipCreateTable     = flag.Bool("skip-init", false, "skip init of tables and topic, all mode recreates them, balancer mode creates missing ones, backend mode never creates them")
 	ydbConnectionString = flag.String("ydb-connection-string", "", "ydb connection string, default "+defaultConnectionString)
 	ydbToken            = flag.String("ydb-token", "", "Auth token for ydb")
 	backendCount        = flag.Int("backend-count", 1, "count of backend servers")
+	backendID           = flag.Int("backend-id", 0, "id of backend in backend mode, backend reads cdc with consumer of its id")
+	backendURLs         = flag.String("backends", "", "comma separated urls of backends in balancer mode")
+	balancePolicy       = flag.String("balance", policyLeastConn, "balance policy in balancer mode: "+policyLeastConn+" or "+policyBusHash)
+	healthInterval      = flag.Duration("health-interval", time.Second, "interval of backends health checks in balancer mode")
+	dlqTopic            = flag.String("dlq", "", "dead-letter topic for cdc events which can't be decoded, they are only skipped if it is empty")
 )
 
 func main() {
 	flag.Parse()
 
 	ctx := context.Background()
-	db := connect()
+	registry := prometheus.NewRegistry()
 
-	if !*skipCreateTable {
-		createTableAndCDC(ctx, db, *backendCount)
+	var handler http.Handler
+	switch *mode {
+	case modeAll:
+		handler = newBackends(ctx, registry, 0, *backendCount)
+	case modeBackend:
+		handler = newBackends(ctx, registry, *backendID, 1)
+	case modeBalancer:
+		if !*skipCreateTable {
+			// backends of other processes may already use the schema, so only missing objects are created
+			createTableAndCDC(ctx, connect(), *backendCount, false)
+		}
+		b, err := newProxyBalancer(strings.Split(*backendURLs, ","), *balancePolicy, registry)
+		if err != nil {
+			log.Fatalf("failed to create balancer: %+v", err)
+		}
+		go b.healthLoop(ctx, *healthInterval)
+		handler = b
+	default:
+		log.Fatalf("unknown mode: %v", *mode)
 	}
 
-	servers := make([]http.Handler, *backendCount)
-	cdcEnabled := !*disableCDC
-	for i := 0; i < *backendCount; i++ {
-		servers[i] = newServer(i, db, *cacheTimeout, cdcEnabled)
-	}
-	log.Printf("servers count: %v", len(servers))
-	handler := newBalancer(servers...)
+	root := http.NewServeMux()
+	root.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	root.Handle("/", handler)
 
 	addr := *host + ":" + strconv.Itoa(*port)
 	log.Printf("Start listen http://%s\n", addr)
-	err := http.ListenAndServe(addr, handler)
-	if errors.Is(err, http.ErrServerClosed) {
+	err := http.ListenAndServe(addr, root)
+	if !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("failed to listen and serve: %+v", err)
 	}
 }
+
+// newBackends creates count servers with ids from firstID, in all mode the servers are balanced in process
+func newBackends(ctx context.Context, registry *prometheus.Registry, firstID, count int) http.Handler {
+	db := connect()
+
+	if *mode == modeAll && !*skipCreateTable {
+		createTableAndCDC(ctx, db, count, true)
+	}
+
+	metrics := httpmetrics.New(registry, "app")
+
+	servers := make([]http.Handler, count)
+	caches := make(map[int]Cache, count)
+	var (
+		cdc       *cdcMetrics
+		publisher *dlq.Publisher
+	)
+	if !*disableCDC {
+		cdc = newCDCMetrics(registry, "app")
+	}
+	if !*disableCDC && *dlqTopic != "" {
+		var err error
+		// producer of every backend process is unique, so their messages are not deduplicated as one sequence
+		publisher, err = dlq.NewPublisher(db, *dlqTopic, fmt.Sprintf("cdc-cache-bus-freeseats-%v", firstID))
+		if err != nil {
+			log.Fatalf("failed to start dead-letter publisher: %+v", err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		id := firstID + i
+		caches[id] = NewCache(*cacheSize, *cacheTimeout, *cacheStale)
+		servers[i] = newServer(id, db, caches[id], cdc, publisher, metrics)
+	}
+	registry.MustRegister(newCacheCollector("app", caches))
+	log.Printf("servers count: %v", len(servers))
+
+	if count == 1 {
+		return servers[0]
+	}
+	return newBalancer(servers...)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	policyLeastConn = "least-conn"
+	policyBusHash   = "bus-hash"
+
+	// ringReplicas is a count of points of every backend on consistent hash ring
+	ringReplicas = 100
+
+	healthCheckTimeout = time.Second
+)
+
+// backend is a backend process behind proxy balancer
+type backend struct {
+	url      *url.URL
+	proxy    *httputil.ReverseProxy
+	healthy  int32
+	inFlight int32
+}
+
+func (b *backend) isHealthy() bool {
+	return atomic.LoadInt32(&b.healthy) != 0
+}
+
+// handleError handles failed proxying of request to backend. Requests canceled by client say nothing about
+// backend, so only real upstream failures exclude backend until the next successful health check.
+func (b *backend) handleError(writer http.ResponseWriter, request *http.Request, err error) {
+	if errors.Is(err, context.Canceled) || request.Context().Err() != nil {
+		return
+	}
+	atomic.StoreInt32(&b.healthy, 0)
+	log.Printf("proxy to %v failed: %+v", b.url, err)
+	http.Error(writer, "Bad gateway", http.StatusBadGateway)
+}
+
+type ringPoint struct {
+	hash    uint32
+	backend *backend
+}
+
+// proxyBalancer proxies requests over http to healthy backends. Requests are routed to backend with the least
+// count of requests in flight, or with bus-hash policy requests of the same bus are routed to the same backend
+// by consistent hashing, so only one backend cache holds the bus.
+type proxyBalancer struct {
+	backends []*backend
+	ring     []ringPoint
+	policy   string
+	counter  uint32
+	client   *http.Client
+	up       *prometheus.GaugeVec
+}
+
+func newProxyBalancer(urls []string, policy string, registerer prometheus.Registerer) (*proxyBalancer, error) {
+	if policy != policyLeastConn && policy != policyBusHash {
+		return nil, fmt.Errorf("unknown balance policy '%s'", policy)
+	}
+	b := &proxyBalancer{
+		policy: policy,
+		client: &http.Client{Timeout: healthCheckTimeout},
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "app",
+			Subsystem: "balancer",
+			Name:      "backend_up",
+			Help:      "health of backend by the last health check",
+		}, []string{"backend"}),
+	}
+	registerer.MustRegister(b.up)
+	for _, u := range urls {
+		target, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(u), "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend url '%s': %w", u, err)
+		}
+		if target.Host == "" {
+			return nil, fmt.Errorf("invalid backend url '%s'", u)
+		}
+		be := &backend{
+			url:   target,
+			proxy: httputil.NewSingleHostReverseProxy(target),
+		}
+		be.proxy.ErrorHandler = be.handleError
+		b.backends = append(b.backends, be)
+		for i := 0; i < ringReplicas; i++ {
+			b.ring = append(b.ring, ringPoint{
+				hash:    hashString(target.String() + "#" + strconv.Itoa(i)),
+				backend: be,
+			})
+		}
+	}
+	if len(b.backends) == 0 {
+		return nil, fmt.Errorf("no backends")
+	}
+	sort.Slice(b.ring, func(i, j int) bool {
+		return b.ring[i].hash < b.ring[j].hash
+	})
+	return b, nil
+}
+
+func (b *proxyBalancer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	be := b.pick(request)
+	if be == nil {
+		http.Error(writer, "No healthy backends", http.StatusServiceUnavailable)
+		return
+	}
+	atomic.AddInt32(&be.inFlight, 1)
+	defer atomic.AddInt32(&be.inFlight, -1)
+	be.proxy.ServeHTTP(writer, request)
+}
+
+func (b *proxyBalancer) pick(request *http.Request) *backend {
+	if b.policy == policyBusHash {
+		if id, ok := busIDFromPath(request.URL.Path); ok {
+			return b.pickByHash(id)
+		}
+	}
+	return b.pickLeastConn()
+}
+
+// pickLeastConn returns healthy backend with the least requests in flight, search starts from the next
+// backend every time, so equally loaded backends are used in turn
+func (b *proxyBalancer) pickLeastConn() (res *backend) {
+	start := int(atomic.AddUint32(&b.counter, 1) % uint32(len(b.backends)))
+	for i := range b.backends {
+		be := b.backends[(start+i)%len(b.backends)]
+		if !be.isHealthy() {
+			continue
+		}
+		if res == nil || atomic.LoadInt32(&be.inFlight) < atomic.LoadInt32(&res.inFlight) {
+			res = be
+		}
+	}
+	return res
+}
+
+// pickByHash returns the first healthy backend on ring after hash of key
+func (b *proxyBalancer) pickByHash(key string) *backend {
+	h := hashString(key)
+	start := sort.Search(len(b.ring), func(i int) bool {
+		return b.ring[i].hash >= h
+	})
+	for i := range b.ring {
+		if be := b.ring[(start+i)%len(b.ring)].backend; be.isHealthy() {
+			return be
+		}
+	}
+	return nil
+}
+
+// healthLoop checks backends every interval until ctx is done
+func (b *proxyBalancer) healthLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		b.checkBackends(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (b *proxyBalancer) checkBackends(ctx context.Context) {
+	for _, be := range b.backends {
+		healthy := b.checkBackend(ctx, be)
+		var v int32
+		if healthy {
+			v = 1
+		}
+		if atomic.SwapInt32(&be.healthy, v) != v {
+			log.Printf("backend %v healthy: %v", be.url, healthy)
+		}
+		b.up.WithLabelValues(be.url.String()).Set(float64(v))
+	}
+}
+
+func (b *proxyBalancer) checkBackend(ctx context.Context, be *backend) bool {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, be.url.String()+"/healthz", nil)
+	if err != nil {
+		return false
+	}
+	response, err := b.client.Do(request)
+	if err != nil {
+		return false
+	}
+	_ = response.Body.Close()
+	return response.StatusCode == http.StatusOK
+}
+
+// busIDFromPath returns bus id of /get/{id} and /buy/{id} requests
+func busIDFromPath(path string) (string, bool) {
+	for _, prefix := range []string{"/get/", "/buy/"} {
+		if strings.HasPrefix(path, prefix) {
+			return path[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// hashString returns well distributed hash of s, fnv hashes of similar strings like bus ids are clustered
+func hashString(s string) uint32 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
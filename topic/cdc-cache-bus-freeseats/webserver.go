@@ -6,37 +6,71 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"path"
 	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/dlq"
+	"github.com/ydb-platform/ydb-go-examples/internal/httpmetrics"
 	"github.com/ydb-platform/ydb-go-sdk/v3"
 	"github.com/ydb-platform/ydb-go-sdk/v3/table"
 	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
 )
 
-var errNotEnthoughtFreeSeats = errors.New("not enough free seats")
+// loadTimeout limits reading of free seats from database into cache, it doesn't depend on request
+// context because the result is shared by all concurrent requests of the same bus
+const loadTimeout = 10 * time.Second
+
+// idempotencyKeyHeader is a request header with client generated purchase id, retried request with the same
+// key returns the result of the original purchase. Html form of index page passes it as idempotencyKeyField.
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	idempotencyKeyField  = "idempotency_key"
+)
+
+var (
+	errNotEnthoughtFreeSeats = errors.New("not enough free seats")
+	errPurchaseNotFound      = errors.New("purchase not found")
+	errIdempotencyKeyReused  = errors.New("idempotency key is used for purchase of another bus")
+)
 
 type server struct {
-	cache     *Cache
-	mux       http.ServeMux
+	cache     Cache
+	loads     singleflight.Group
+	router    *mux.Router
 	db        ydb.Connection
 	dbCounter int64
 	id        int
+	cdc       *cdcMetrics
+	cdcStatus atomic.Value
+	dlq       *dlq.Publisher
 }
 
-func newServer(id int, db ydb.Connection, cacheTimeout time.Duration, useCDC bool) *server {
+func newServer(
+	id int, db ydb.Connection, cache Cache, cdc *cdcMetrics, publisher *dlq.Publisher, metrics *httpmetrics.Metrics,
+) *server {
 	res := &server{
-		cache: NewCache(cacheTimeout),
-		db:    db,
-		id:    id,
+		cache:  cache,
+		router: mux.NewRouter(),
+		db:     db,
+		id:     id,
+		cdc:    cdc,
+		dlq:    publisher,
 	}
 
-	res.mux.HandleFunc("/", res.IndexPageHandler)
-	res.mux.HandleFunc("/get/", res.GetFreeSeatsHandler)
-	res.mux.HandleFunc("/buy/", res.BuyTicketHandler)
+	res.router.Use(metrics.Middleware)
+	res.router.HandleFunc("/", res.IndexPageHandler)
+	res.router.HandleFunc("/healthz", res.HealthHandler)
+	res.router.HandleFunc("/get/{id}", res.GetFreeSeatsHandler)
+	res.router.HandleFunc("/buy/{id}", res.BuyTicketHandler).Methods(http.MethodPost)
+	res.router.HandleFunc("/cancel/{id}", res.CancelTicketHandler).Methods(http.MethodPost)
 
-	if useCDC {
+	// cdc is disabled when cdc metrics are nil
+	if cdc != nil {
+		res.setCDCStatus(false, errCDCNotStarted)
 		go res.cdcLoop()
 	}
 
@@ -44,12 +78,12 @@ func newServer(id int, db ydb.Connection, cacheTimeout time.Duration, useCDC boo
 }
 
 func (s *server) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	s.mux.ServeHTTP(writer, request)
+	s.router.ServeHTTP(writer, request)
 }
 
 func (s *server) GetFreeSeatsHandler(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
-	id := path.Base(request.URL.Path)
+	id := mux.Vars(request)["id"]
 
 	start := time.Now()
 	freeSeats, err := s.getFreeSeats(ctx, id)
@@ -63,39 +97,107 @@ func (s *server) GetFreeSeatsHandler(writer http.ResponseWriter, request *http.R
 
 func (s *server) BuyTicketHandler(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
-	id := path.Base(request.URL.Path)
+	id := mux.Vars(request)["id"]
+
+	// key is generated by client, so retry of request which response is lost doesn't sell one more ticket
+	purchaseID := request.Header.Get(idempotencyKeyHeader)
+	if purchaseID == "" {
+		purchaseID = request.PostFormValue(idempotencyKeyField)
+	}
+	if purchaseID == "" {
+		http.Error(writer, idempotencyKeyHeader+" header is required", http.StatusBadRequest)
+		return
+	}
 
 	start := time.Now()
-	freeSeats, err := s.sellTicket(ctx, id)
+	freeSeats, err := s.sellTicket(ctx, id, purchaseID)
 	if err != nil {
-		if errors.Is(err, errNotEnthoughtFreeSeats) {
+		switch {
+		case errors.Is(err, errNotEnthoughtFreeSeats):
 			http.Error(writer, "Not enough free seats", http.StatusPreconditionFailed)
-		} else {
+		case errors.Is(err, errIdempotencyKeyReused):
+			http.Error(writer, err.Error(), http.StatusConflict)
+		default:
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 		}
 		return
 	}
 	// s.cache.Delete(id) // used without cdc, for single-instance application
 	duration := time.Since(start)
+	writer.Header().Set(idempotencyKeyHeader, purchaseID)
 	s.writeAnswer(writer, freeSeats, duration)
+	_, _ = fmt.Fprintf(writer, "Purchase: %v\nCancel: /cancel/%v\n", purchaseID, purchaseID)
+}
+
+func (s *server) CancelTicketHandler(writer http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+	purchaseID := mux.Vars(request)["id"]
+
+	start := time.Now()
+	freeSeats, err := s.cancelTicket(ctx, purchaseID)
+	if err != nil {
+		if errors.Is(err, errPurchaseNotFound) {
+			http.Error(writer, "Purchase not found", http.StatusNotFound)
+		} else {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	duration := time.Since(start)
+	s.writeAnswer(writer, freeSeats, duration)
+}
+
+// HealthHandler reports whether server may serve requests. Server with cdc is unhealthy while its cdc reader
+// is not running, because its cache is not invalidated by changes of other backends.
+func (s *server) HealthHandler(writer http.ResponseWriter, request *http.Request) {
+	if s.cdc != nil {
+		if status := s.cdcStatus.Load().(cdcStatus); !status.running {
+			http.Error(writer, fmt.Sprintf("cdc reader is not running: %v", status.err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	_, _ = io.WriteString(writer, "ok")
 }
 
 func (s *server) writeAnswer(writer http.ResponseWriter, freeSeats int64, duration time.Duration) {
 	_, _ = fmt.Fprintf(writer, "%v\n\nDuration: %v\n", freeSeats, duration)
 }
 
+// getFreeSeats returns free seats from cache. Stale value is returned at once and refreshed in background.
+// Concurrent misses of the same bus issue one database read.
 func (s *server) getFreeSeats(ctx context.Context, id string) (int64, error) {
-	if content, ok := s.cache.Get(id); ok {
-		return content, nil
+	freeSeats, fresh, ok := s.cache.Get(id)
+	if fresh {
+		return freeSeats, nil
+	}
+	if ok {
+		s.loads.DoChan(id, s.loadToCache(id))
+		return freeSeats, nil
+	}
+
+	select {
+	case res := <-s.loads.DoChan(id, s.loadToCache(id)):
+		if res.Err != nil {
+			return 0, res.Err
+		}
+		return res.Val.(int64), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
 	}
+}
 
-	freeSeats, err := s.getContentFromDB(ctx, id)
+func (s *server) loadToCache(id string) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		defer cancel()
 
-	if err == nil {
+		freeSeats, err := s.getContentFromDB(ctx, id)
+		if err != nil {
+			return nil, err
+		}
 		s.cache.Set(id, freeSeats)
+		return freeSeats, nil
 	}
-
-	return freeSeats, err
 }
 
 func (s *server) getContentFromDB(ctx context.Context, id string) (int64, error) {
@@ -139,31 +241,116 @@ SELECT freeSeats FROM bus WHERE id=$id;
 	return freeSeats, nil
 }
 
-func (s *server) sellTicket(ctx context.Context, id string) (int64, error) {
+// sellTicket sells one seat of bus and stores purchase in the same transaction. Purchase with the same id
+// is sold once, so retried request (and retried transaction) returns the result of the first one.
+func (s *server) sellTicket(ctx context.Context, id, purchaseID string) (int64, error) {
 	var freeSeats int64
 	err := s.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
-		var err error
+		p, err := s.getPurchaseTx(ctx, tx, purchaseID)
+		switch {
+		case err == nil:
+			if p.busID != id {
+				return errIdempotencyKeyReused
+			}
+			freeSeats = p.freeSeats
+			return nil
+		case !errors.Is(err, errPurchaseNotFound):
+			return err
+		}
+
 		freeSeats, err = s.getFreeSeatsTx(ctx, tx, id)
 		if err != nil {
 			return err
 		}
-		if freeSeats < 0 {
+		if freeSeats <= 0 {
 			return fmt.Errorf("failed to sell ticket: %w", errNotEnthoughtFreeSeats)
 		}
+		freeSeats--
 
 		_, err = tx.Execute(ctx, `
 DECLARE $id AS Text;
+DECLARE $purchaseId AS Text;
+DECLARE $freeSeats AS Int64;
 
 UPDATE bus SET freeSeats = freeSeats - 1 WHERE id=$id;
-`, table.NewQueryParameters(table.ValueParam("$id", types.UTF8Value(id))))
+
+UPSERT INTO purchases (id, busId, freeSeats, cancelled) VALUES ($purchaseId, $id, $freeSeats, false);
+`, table.NewQueryParameters(
+			table.ValueParam("$id", types.UTF8Value(id)),
+			table.ValueParam("$purchaseId", types.UTF8Value(purchaseID)),
+			table.ValueParam("$freeSeats", types.Int64Value(freeSeats)),
+		))
+		return err
+	})
+	return freeSeats, err
+}
+
+// cancelTicket restores seat of purchase and returns free seats of its bus. Cancelled purchase is not
+// restored twice.
+func (s *server) cancelTicket(ctx context.Context, purchaseID string) (int64, error) {
+	var freeSeats int64
+	err := s.db.Table().DoTx(ctx, func(ctx context.Context, tx table.TransactionActor) error {
+		p, err := s.getPurchaseTx(ctx, tx, purchaseID)
+		if err != nil {
+			return err
+		}
+		freeSeats, err = s.getFreeSeatsTx(ctx, tx, p.busID)
+		if err != nil {
+			return err
+		}
+		if p.cancelled {
+			return nil
+		}
+		freeSeats++
+
+		_, err = tx.Execute(ctx, `
+DECLARE $id AS Text;
+DECLARE $purchaseId AS Text;
+
+UPDATE bus SET freeSeats = freeSeats + 1 WHERE id=$id;
+
+UPDATE purchases SET cancelled = true WHERE id=$purchaseId;
+`, table.NewQueryParameters(
+			table.ValueParam("$id", types.UTF8Value(p.busID)),
+			table.ValueParam("$purchaseId", types.UTF8Value(purchaseID)),
+		))
 		return err
 	})
-	if err == nil {
-		freeSeats--
-	}
 	return freeSeats, err
 }
 
+type purchase struct {
+	busID     string
+	freeSeats int64
+	cancelled bool
+}
+
+func (s *server) getPurchaseTx(ctx context.Context, tx table.TransactionActor, purchaseID string) (p purchase, err error) {
+	res, err := tx.Execute(ctx, `
+DECLARE $id AS Text;
+
+SELECT busId, freeSeats, cancelled FROM purchases WHERE id=$id;
+`, table.NewQueryParameters(table.ValueParam("$id", types.UTF8Value(purchaseID))))
+	if err != nil {
+		return p, err
+	}
+	defer func() {
+		_ = res.Close()
+	}()
+
+	err = res.NextResultSetErr(ctx, "busId", "freeSeats", "cancelled")
+	if err != nil {
+		return p, err
+	}
+
+	if !res.NextRow() {
+		return p, errPurchaseNotFound
+	}
+
+	err = res.ScanWithDefaults(&p.busID, &p.freeSeats, &p.cancelled)
+	return p, err
+}
+
 func (s *server) IndexPageHandler(writer http.ResponseWriter, request *http.Request) {
 	ctx := request.Context()
 
@@ -203,15 +390,18 @@ func (s *server) IndexPageHandler(writer http.ResponseWriter, request *http.Requ
 	<tr>
 		<th>ID</th>
 		<th>Get free seats link</th>
-		<th>Buy ticket link</th>
+		<th>Buy ticket</th>
 	</tr>
 `)
 	for _, id := range busIDs {
 		_, _ = fmt.Fprintf(writer, `<tr>
 	<td>%v</td>
 	<td><a href="/get/%v">/get/%v</a></td>
-	<td><a href="/buy/%v">/buy/%v</a></td>
-</tr>`, id, id, id, id, id)
+	<td><form method="post" action="/buy/%v">
+		<input type="hidden" name="%v" value="%v" />
+		<input type="submit" value="/buy/%v" />
+	</form></td>
+</tr>`, id, id, id, id, idempotencyKeyField, uuid.NewString(), id)
 	}
 	_, _ = io.WriteString(writer, "</table>")
 }
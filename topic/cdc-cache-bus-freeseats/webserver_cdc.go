@@ -2,59 +2,203 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"path"
+	"strconv"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
-	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicsugar"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/cdc"
+	"github.com/ydb-platform/ydb-go-examples/internal/dlq"
+)
+
+const (
+	cdcMinBackoff = 100 * time.Millisecond
+	cdcMaxBackoff = 30 * time.Second
 )
 
+var errCDCNotStarted = errors.New("cdc reader is not started yet")
+
+// cdcStatus is a state of cdc reader of server, err is the last error of stopped reader
+type cdcStatus struct {
+	running bool
+	err     error
+}
+
+func (s *server) setCDCStatus(running bool, err error) {
+	s.cdcStatus.Store(cdcStatus{running: running, err: err})
+}
+
+// bus is a row of bus table
+type bus struct {
+	ID        string `cdc:"id"`
+	FreeSeats int64  `cdc:"freeSeats"`
+}
+
+// cdcMetrics are metrics of cdc listeners of backend servers
+type cdcMetrics struct {
+	lag     *prometheus.GaugeVec
+	events  *prometheus.CounterVec
+	errors  *prometheus.CounterVec
+	resyncs *prometheus.CounterVec
+}
+
+func newCDCMetrics(registerer prometheus.Registerer, namespace string) *cdcMetrics {
+	m := &cdcMetrics{
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "cdc",
+			Name:      "lag_seconds",
+			Help:      "delay between write of the last applied cdc event and its applying",
+		}, []string{"server"}),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cdc",
+			Name:      "events_applied_total",
+			Help:      "count of cdc events applied to cache",
+		}, []string{"server", "type"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cdc",
+			Name:      "errors_total",
+			Help:      "count of cdc listener errors",
+		}, []string{"server", "stage"}),
+		resyncs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cdc",
+			Name:      "cache_resyncs_total",
+			Help:      "count of whole cache invalidations after gaps in cdc events",
+		}, []string{"server"}),
+	}
+	registerer.MustRegister(m.lag, m.events, m.errors, m.resyncs)
+	return m
+}
+
+// cdcLoop applies cdc events to cache until process exits. Reader resumes from offsets committed by
+// consumer of server. After read error the reader is restarted with backoff and whole cache is invalidated,
+// because cached values may be changed by events which are not applied yet.
 func (s *server) cdcLoop() {
 	ctx := context.Background()
-	consumer := consumerName(s.id)
-	reader, err := s.db.Topic().StartReader(consumer, topicoptions.ReadSelectors{
+	backoff := cdcMinBackoff
+
+	log.Printf("Start cdc listen for server: %v", s.id)
+	for {
+		applied, stage, err := s.readCDC(ctx)
+		s.setCDCStatus(false, fmt.Errorf("%v failed: %w", stage, err))
+		s.cdcFailed(stage, err)
+
+		if applied {
+			backoff = cdcMinBackoff
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > cdcMaxBackoff {
+			backoff = cdcMaxBackoff
+		}
+	}
+}
+
+// readCDC starts reader and applies events until error. It returns stage of error and whether any events
+// were applied.
+func (s *server) readCDC(ctx context.Context) (applied bool, stage string, err error) {
+	decoder, err := cdc.DescribeDecoder[bus](ctx, s.db.Table(), path.Join(s.db.Name(), "bus"))
+	if err != nil {
+		return false, "start", err
+	}
+
+	reader, err := s.db.Topic().StartReader(consumerName(s.id), topicoptions.ReadSelectors{
 		{
-			Path:     "bus/updates",
-			ReadFrom: time.Now(),
+			Path: "bus/updates",
 		},
 	},
 	)
 	if err != nil {
-		log.Fatalf("failed to start reader: %+v", err)
+		return false, "start", err
+	}
+	defer func() {
+		_ = reader.Close(ctx)
+	}()
+	s.setCDCStatus(true, nil)
+
+	handler := func(ctx context.Context, msg *topicreader.Message, data []byte) error {
+		if err := s.applyCDCEvent(decoder, msg, data); err != nil {
+			// broken event is skipped, its key is unknown, so whole cache is invalidated
+			s.cdcFailed("unmarshal", err)
+			return dlq.Permanent(err)
+		}
+		return nil
+	}
+	var processor *dlq.Processor
+	if s.dlq != nil {
+		processor = dlq.NewProcessor(s.dlq, dlq.DefaultRetryPolicy, handler)
 	}
 
-	log.Printf("Start cdc listen for server: %v", s.id)
 	for {
 		msg, err := reader.ReadMessage(ctx)
 		if err != nil {
-			log.Fatalf("failed to read message: %+v", err)
+			return applied, "read", err
 		}
 
-		var cdcEvent struct {
-			Key    []string
-			Update struct {
-				FreeSeats int64
+		if processor != nil {
+			// broken event is published to dead-letter topic, it is committed only after publishing
+			if err = processor.Process(ctx, msg); err != nil {
+				return applied, "dlq", err
 			}
-			Erase *struct{}
-		}
-
-		err = topicsugar.JSONUnmarshal(msg, &cdcEvent)
-		if err != nil {
-			log.Fatalf("failed to unmarshal message: %+v", err)
-		}
-
-		busID := cdcEvent.Key[0]
-		// s.dropFromCache(busID) // used for clean cache and force database request
-		if cdcEvent.Erase == nil {
-			s.cache.Set(busID, cdcEvent.Update.FreeSeats) // used for direct update cache from cdc without database request
-			log.Println("server-id:", s.id, "Update record: ", busID, "set freeseats:", cdcEvent.Update.FreeSeats)
 		} else {
-			log.Println("server-id:", s.id, "Remove record from cache: ", busID)
-			s.cache.Delete(busID)
+			data, err := io.ReadAll(msg)
+			if err != nil {
+				return applied, "read", err
+			}
+			_ = handler(ctx, msg, data)
 		}
+		applied = true
+
 		err = reader.Commit(ctx, msg)
 		if err != nil {
-			log.Printf("failed to commit message: %+v", err)
+			return applied, "commit", err
 		}
 	}
 }
+
+func (s *server) applyCDCEvent(decoder *cdc.Decoder[bus], msg *topicreader.Message, data []byte) error {
+	event, err := decoder.Decode(data)
+	if err != nil {
+		return err
+	}
+	if event.Operation == cdc.OperationResolved {
+		return nil
+	}
+
+	label := strconv.Itoa(s.id)
+	busID := event.Key.ID
+	// s.dropFromCache(busID) // used for clean cache and force database request
+	if event.Operation == cdc.OperationUpsert && event.Changed("freeSeats") {
+		freeSeats := event.NewImage.FreeSeats
+		s.cache.Set(busID, freeSeats) // used for direct update cache from cdc without database request
+		log.Println("server-id:", s.id, "Update record: ", busID, "set freeseats:", freeSeats)
+		s.cdc.events.WithLabelValues(label, "update").Inc()
+	} else {
+		log.Println("server-id:", s.id, "Remove record from cache: ", busID)
+		s.cache.Delete(busID)
+		s.cdc.events.WithLabelValues(label, "erase").Inc()
+	}
+	s.cdc.lag.WithLabelValues(label).Set(time.Since(msg.WrittenAt).Seconds())
+	return nil
+}
+
+// cdcFailed registers error of cdc listener and invalidates cache
+func (s *server) cdcFailed(stage string, err error) {
+	label := strconv.Itoa(s.id)
+	s.cdc.errors.WithLabelValues(label, stage).Inc()
+	log.Printf("server-id: %v cdc %v failed: %+v", s.id, stage, err)
+
+	s.cache.Clear()
+	s.cdc.resyncs.WithLabelValues(label).Inc()
+}
@@ -3,37 +3,167 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"time"
 
 	"github.com/ydb-platform/ydb-go-sdk/v3"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
-	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicsugar"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/cdc"
+	"github.com/ydb-platform/ydb-go-examples/internal/dlq"
 )
 
-func cdcRead(ctx context.Context, db ydb.Connection, consumerName, topicPath string) {
+// row is a row of cdc table
+type row struct {
+	ID    uint64  `cdc:"id" json:"id"`
+	Value *string `cdc:"value" json:"value"`
+}
+
+func (r *row) String() string {
+	if r == nil {
+		return "<nil>"
+	}
+	if r.Value == nil {
+		return fmt.Sprintf("{id: %v, value: NULL}", r.ID)
+	}
+	return fmt.Sprintf("{id: %v, value: %q}", r.ID, *r.Value)
+}
+
+// keyString returns description of key columns of row
+func (r *row) keyString() string {
+	return fmt.Sprintf("{id: %v}", r.ID)
+}
+
+// record is a cdc event with its position in changefeed, it is passed to sinks
+type record struct {
+	Operation cdc.Operation `json:"operation"`
+	Key       row           `json:"key"`
+	NewImage  *row          `json:"new_image,omitempty"`
+	OldImage  *row          `json:"old_image,omitempty"`
+	Offset    int64         `json:"offset"`
+	WrittenAt time.Time     `json:"written_at"`
+}
+
+// cdcBatch is a batch of records which is committed at once
+type cdcBatch struct {
+	records []record
+	// batch is a topic batch of records, it is nil if batch is not read from topic
+	batch *topicreader.Batch
+}
+
+// cdcReader is a source of cdc records
+type cdcReader interface {
+	ReadBatch(ctx context.Context) (cdcBatch, error)
+	Commit(ctx context.Context, batch cdcBatch) error
+}
+
+// topicCDCReader reads and decodes cdc records from changefeed. Messages which can't be decoded are published
+// to dead-letter topic by processor if it is set, otherwise reading fails on them.
+type topicCDCReader struct {
+	reader    *topicreader.Reader
+	decoder   *cdc.Decoder[row]
+	processor *dlq.Processor
+	// records are decoded records of the current batch
+	records []record
+}
+
+func newTopicCDCReader(reader *topicreader.Reader, decoder *cdc.Decoder[row], p *dlq.Publisher) *topicCDCReader {
+	r := &topicCDCReader{reader: reader, decoder: decoder}
+	if p != nil {
+		r.processor = dlq.NewProcessor(p, dlq.DefaultRetryPolicy, r.decode)
+	}
+	return r
+}
+
+func (r *topicCDCReader) ReadBatch(ctx context.Context) (b cdcBatch, err error) {
+	b.batch, err = r.reader.ReadMessageBatch(ctx)
+	if err != nil {
+		return b, fmt.Errorf("failed to read message: %w", err)
+	}
+	r.records = make([]record, 0, len(b.batch.Messages))
+	for _, msg := range b.batch.Messages {
+		if r.processor != nil {
+			err = r.processor.Process(ctx, msg)
+		} else {
+			err = r.read(ctx, msg)
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+	b.records = r.records
+	return b, nil
+}
+
+func (r *topicCDCReader) read(ctx context.Context, msg *topicreader.Message) error {
+	data, err := io.ReadAll(msg)
+	if err != nil {
+		return fmt.Errorf("failed to read message: %w", err)
+	}
+	return r.decode(ctx, msg, data)
+}
+
+// decode appends record of message to records of the current batch, malformed message is never decoded,
+// so its error is permanent
+func (r *topicCDCReader) decode(_ context.Context, msg *topicreader.Message, data []byte) error {
+	event, err := r.decoder.Decode(data)
+	if err != nil {
+		return dlq.Permanent(fmt.Errorf("failed to unmarshal json cdc: %w", err))
+	}
+	r.records = append(r.records, record{
+		Operation: event.Operation,
+		Key:       event.Key,
+		NewImage:  event.NewImage,
+		OldImage:  event.OldImage,
+		Offset:    msg.Offset,
+		WrittenAt: msg.WrittenAt,
+	})
+	return nil
+}
+
+func (r *topicCDCReader) Commit(ctx context.Context, b cdcBatch) error {
+	return r.reader.Commit(ctx, b.batch)
+}
+
+func cdcRead(
+	ctx context.Context, db ydb.Connection, consumerName, tablePath, topicPath string, s sink, p *dlq.Publisher,
+) error {
+	decoder, err := cdc.DescribeDecoder[row](ctx, db.Table(), tablePath)
+	if err != nil {
+		return fmt.Errorf("failed to create cdc decoder: %w", err)
+	}
+
 	// Connect to changefeed
 
 	log.Println("Start cdc read")
-	reader, err := db.Topic().StartReader(consumerName, []topicoptions.ReadSelector{{Path: topicPath}})
+	reader, err := db.Topic().StartReader(consumerName, []topicoptions.ReadSelector{{Path: topicPath}},
+		topicoptions.WithBatchReadMaxCount(batchSize),
+	)
 	if err != nil {
-		log.Fatal("failed to start read feed", err)
+		return fmt.Errorf("failed to start read feed: %w", err)
 	}
+	defer func() {
+		_ = reader.Close(ctx)
+	}()
 
+	return pump(ctx, newTopicCDCReader(reader, decoder, p), s)
+}
+
+// pump writes records from reader to sink. Batch is committed only after sink accepted it, so records which
+// are not accepted are read again after restart.
+func pump(ctx context.Context, r cdcReader, s sink) error {
 	for {
-		msg, err := reader.ReadMessage(ctx)
+		b, err := r.ReadBatch(ctx)
 		if err != nil {
-			panic(fmt.Errorf("failed to read message: %+v", err))
+			return err
 		}
-
-		var event interface{}
-		err = topicsugar.JSONUnmarshal(msg, &event)
-		if err != nil {
-			panic(fmt.Errorf("failed to unmarshal json cdc: %+v", err))
+		if err = s.Write(ctx, b.records); err != nil {
+			return fmt.Errorf("failed to write to sink: %w", err)
 		}
-		log.Println("new cdc event:", event)
-		err = reader.Commit(ctx, msg)
-		if err != nil {
-			panic(fmt.Errorf("failed to commit message: %+v", err))
+		if err = r.Commit(ctx, b); err != nil {
+			return fmt.Errorf("failed to commit message: %w", err)
 		}
 	}
 }
@@ -5,20 +5,34 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"path"
 	"time"
 
+	"github.com/google/uuid"
 	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
 
 	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topictypes"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/dlq"
 )
 
 var (
 	dsn               string
 	useEnvCredentials bool
+
+	sinkType     string
+	stdoutFormat string
+	sinkDir      string
+	maxFileSize  int64
+	webhookURL   string
+	batchSize    int
+	retries      int
+	retryBackoff time.Duration
+	dlqTopic     string
 )
 
 func main() {
@@ -54,7 +68,25 @@ func main() {
 		removeFromTable(ctx, db.Table(), prefix, tableName)
 	}()
 
-	cdcRead(ctx, db, consumerName, topicPath)
+	s, err := newSink()
+	if err != nil {
+		panic(fmt.Errorf("create sink error: %w", err))
+	}
+	defer func() { _ = s.Close() }()
+
+	var p *dlq.Publisher
+	if dlqTopic != "" {
+		prepareDeadLetterTopic(ctx, db, dlqTopic)
+		// producer is unique for every run, so concurrent runs don't write one sequence of messages
+		if p, err = dlq.NewPublisher(db, dlqTopic, "cdc-fill-and-read-"+uuid.NewString()); err != nil {
+			panic(err)
+		}
+		defer func() { _ = p.Close(ctx) }()
+	}
+
+	if err = cdcRead(ctx, db, consumerName, path.Join(prefix, tableName), topicPath, s, p); err != nil {
+		panic(fmt.Errorf("cdc read error: %w", err))
+	}
 }
 
 func readFlags() {
@@ -73,10 +105,74 @@ func readFlags() {
 		"use-env-credentials", false,
 		"Use credentials from env variables",
 	)
+	flagSet.StringVar(&sinkType,
+		"sink", "stdout",
+		"sink of cdc events: stdout, file or webhook",
+	)
+	flagSet.StringVar(&stdoutFormat,
+		"format", "pretty",
+		"format of stdout sink: pretty or json",
+	)
+	flagSet.StringVar(&sinkDir,
+		"dir", "cdc",
+		"directory of JSON lines files of file sink",
+	)
+	flagSet.Int64Var(&maxFileSize,
+		"max-file-size", 64<<20,
+		"size of file after which file sink rotates it",
+	)
+	flagSet.StringVar(&webhookURL,
+		"webhook", "",
+		"url of webhook sink",
+	)
+	flagSet.IntVar(&batchSize,
+		"batch-size", 100,
+		"max count of events read and posted to webhook at once",
+	)
+	flagSet.IntVar(&retries,
+		"retries", 5,
+		"count of retries of failed webhook request",
+	)
+	flagSet.DurationVar(&retryBackoff,
+		"retry-backoff", 100*time.Millisecond,
+		"delay before the first retry of webhook request, it doubles every retry",
+	)
+	flagSet.StringVar(&dlqTopic,
+		"dlq", "",
+		"dead-letter topic for changefeed messages which can't be decoded, reading stops on them if it is empty",
+	)
 	if err := flagSet.Parse(os.Args[1:]); err != nil {
 		flagSet.Usage()
 		os.Exit(1)
 	}
+	if batchSize < 1 {
+		batchSize = 1
+	}
+}
+
+func newSink() (sink, error) {
+	switch sinkType {
+	case "stdout":
+		if stdoutFormat != "pretty" && stdoutFormat != "json" {
+			return nil, fmt.Errorf("unknown format '%s'", stdoutFormat)
+		}
+		return &stdoutSink{w: os.Stdout, pretty: stdoutFormat == "pretty"}, nil
+	case "file":
+		return newFileSink(sinkDir, maxFileSize)
+	case "webhook":
+		if webhookURL == "" {
+			return nil, fmt.Errorf("webhook url is required")
+		}
+		return &webhookSink{
+			url:       webhookURL,
+			client:    &http.Client{Timeout: 10 * time.Second},
+			batchSize: batchSize,
+			retries:   retries,
+			backoff:   retryBackoff,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink '%s'", sinkType)
+	}
 }
 
 func prepareTableWithCDC(ctx context.Context, db ydb.Connection, prefix, tableName, topicPath, consumerName string) {
@@ -110,3 +206,17 @@ func prepareTableWithCDC(ctx context.Context, db ydb.Connection, prefix, tableNa
 		panic(fmt.Errorf("failed to create feed consumer: %+v", err))
 	}
 }
+
+// prepareDeadLetterTopic creates dead-letter topic with consumer of redrive command if it doesn't exist
+func prepareDeadLetterTopic(ctx context.Context, db ydb.Connection, topicPath string) {
+	if _, err := db.Topic().Describe(ctx, topicPath); err == nil {
+		return
+	}
+	log.Println("Create dead-letter topic")
+	err := db.Topic().Create(ctx, topicPath,
+		topicoptions.CreateWithConsumer(topictypes.Consumer{Name: "redrive"}),
+	)
+	if err != nil {
+		panic(fmt.Errorf("failed to create dead-letter topic: %w", err))
+	}
+}
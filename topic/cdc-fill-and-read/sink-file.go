@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// fileSink writes records as JSON lines to files in dir. Current file is rotated when its size exceeds maxSize.
+type fileSink struct {
+	dir     string
+	maxSize int64
+	now     func() time.Time
+
+	m    sync.Mutex
+	f    *os.File
+	size int64
+	seq  int
+}
+
+func newFileSink(dir string, maxSize int64) (*fileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileSink{
+		dir:     dir,
+		maxSize: maxSize,
+		now:     time.Now,
+	}, nil
+}
+
+// Write appends records to current file and syncs it to disk
+func (s *fileSink) Write(_ context.Context, records []record) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if s.f == nil || s.size >= s.maxSize {
+		if err := s.rotateNeedLock(); err != nil {
+			return err
+		}
+	}
+	var data []byte
+	for i := range records {
+		line, err := json.Marshal(&records[i])
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	n, err := s.f.Write(data)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+func (s *fileSink) rotateNeedLock() error {
+	if err := s.closeNeedLock(); err != nil {
+		return err
+	}
+	s.seq++
+	name := filepath.Join(s.dir, fmt.Sprintf("cdc-%s-%04d.jsonl", s.now().UTC().Format("20060102T150405"), s.seq))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.f, s.size = f, info.Size()
+	return nil
+}
+
+func (s *fileSink) closeNeedLock() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *fileSink) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.closeNeedLock()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// errPermanent is an error of webhook request which is not retried
+var errPermanent = errors.New("permanent webhook error")
+
+// webhookSink posts records as JSON arrays of up to batchSize records. Failed requests are retried with
+// exponential backoff, records are accepted when webhook responds with 2xx status.
+type webhookSink struct {
+	url       string
+	client    *http.Client
+	batchSize int
+	retries   int
+	backoff   time.Duration
+}
+
+func (s *webhookSink) Write(ctx context.Context, records []record) error {
+	for len(records) > 0 {
+		n := len(records)
+		if n > s.batchSize {
+			n = s.batchSize
+		}
+		if err := s.post(ctx, records[:n]); err != nil {
+			return err
+		}
+		records = records[n:]
+	}
+	return nil
+}
+
+func (s *webhookSink) post(ctx context.Context, records []record) error {
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err = s.postOnce(ctx, body)
+		if err == nil || errors.Is(err, errPermanent) || attempt >= s.retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (s *webhookSink) postOnce(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	switch {
+	case response.StatusCode < http.StatusMultipleChoices:
+		return nil
+	case response.StatusCode >= http.StatusInternalServerError, response.StatusCode == http.StatusTooManyRequests:
+		return fmt.Errorf("webhook '%s' responded with status %d", s.url, response.StatusCode)
+	default:
+		return fmt.Errorf("%w: webhook '%s' responded with status %d", errPermanent, s.url, response.StatusCode)
+	}
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
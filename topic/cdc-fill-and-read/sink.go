@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// sink accepts cdc records, Write returns nil only after all records are durably accepted
+type sink interface {
+	Write(ctx context.Context, records []record) error
+	Close() error
+}
+
+// stdoutSink prints records as JSON lines or in human readable form
+type stdoutSink struct {
+	m      sync.Mutex
+	w      io.Writer
+	pretty bool
+}
+
+func (s *stdoutSink) Write(_ context.Context, records []record) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	enc := json.NewEncoder(s.w)
+	for i := range records {
+		var err error
+		if s.pretty {
+			_, err = fmt.Fprintln(s.w, records[i].String())
+		} else {
+			err = enc.Encode(&records[i])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stdoutSink) Close() error {
+	return nil
+}
+
+// String returns one line description of record
+func (r *record) String() string {
+	return fmt.Sprintf("%s #%d %s key: %v old: %v new: %v",
+		r.WrittenAt.Format("15:04:05.000"), r.Offset, r.Operation, r.Key.keyString(), r.OldImage, r.NewImage,
+	)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/cdc"
+)
+
+// fakeReader returns batches and then io.EOF, it records committed batches
+type fakeReader struct {
+	batches   [][]record
+	committed [][]record
+}
+
+func (r *fakeReader) ReadBatch(context.Context) (cdcBatch, error) {
+	if len(r.batches) == 0 {
+		return cdcBatch{}, io.EOF
+	}
+	b := cdcBatch{records: r.batches[0]}
+	r.batches = r.batches[1:]
+	return b, nil
+}
+
+func (r *fakeReader) Commit(_ context.Context, b cdcBatch) error {
+	r.committed = append(r.committed, b.records)
+	return nil
+}
+
+// failingSink rejects all records
+type failingSink struct{}
+
+func (failingSink) Write(context.Context, []record) error { return errors.New("rejected") }
+
+func (failingSink) Close() error { return nil }
+
+func testRecords(n int) []record {
+	records := make([]record, n)
+	for i := range records {
+		value := "val-" + string(rune('a'+i))
+		records[i] = record{
+			Operation: cdc.OperationUpsert,
+			Key:       row{ID: uint64(i)},
+			NewImage:  &row{ID: uint64(i), Value: &value},
+			Offset:    int64(i),
+			WrittenAt: time.Date(2023, 1, 1, 0, 0, i, 0, time.UTC),
+		}
+	}
+	return records
+}
+
+func TestPumpCommitsAcceptedBatches(t *testing.T) {
+	records := testRecords(3)
+	r := &fakeReader{batches: [][]record{records[:2], records[2:]}}
+	buf := &bytes.Buffer{}
+
+	err := pump(context.Background(), r, &stdoutSink{w: buf})
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.committed) != 2 {
+		t.Fatalf("committed %d batches, want 2", len(r.committed))
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 3 {
+		t.Fatalf("written %d records, want 3", lines)
+	}
+}
+
+func TestPumpDoesNotCommitRejectedBatch(t *testing.T) {
+	r := &fakeReader{batches: [][]record{testRecords(1)}}
+
+	err := pump(context.Background(), r, failingSink{})
+	if err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.committed) != 0 {
+		t.Fatalf("committed %d batches, want 0", len(r.committed))
+	}
+}
+
+func TestStdoutSink(t *testing.T) {
+	records := testRecords(1)
+	buf := &bytes.Buffer{}
+	if err := (&stdoutSink{w: buf}).Write(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	var got record
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Key.ID != 0 || got.Operation != cdc.OperationUpsert || *got.NewImage.Value != "val-a" {
+		t.Fatalf("unexpected record: %+v", got)
+	}
+
+	buf.Reset()
+	if err := (&stdoutSink{w: buf, pretty: true}).Write(context.Background(), records); err != nil {
+		t.Fatal(err)
+	}
+	want := `00:00:00.000 #0 upsert key: {id: 0} old: <nil> new: {id: 0, value: "val-a"}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newFileSink(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeReader{batches: [][]record{testRecords(2), testRecords(1)}}
+	if err = pump(context.Background(), r, s); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	lines := 0
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var got record
+			if err = json.Unmarshal(scanner.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			lines++
+		}
+		_ = f.Close()
+	}
+	if lines != 3 {
+		t.Fatalf("got %d records, want 3", lines)
+	}
+}
+
+func TestWebhookSinkRetriesAndBatches(t *testing.T) {
+	var (
+		m       sync.Mutex
+		calls   int
+		batches []int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var records []record
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, len(records))
+	}))
+	defer server.Close()
+
+	s := &webhookSink{
+		url:       server.URL,
+		client:    server.Client(),
+		batchSize: 2,
+		retries:   1,
+		backoff:   time.Millisecond,
+	}
+	r := &fakeReader{batches: [][]record{testRecords(3)}}
+	if err := pump(context.Background(), r, s); !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(r.committed) != 1 {
+		t.Fatalf("committed %d batches, want 1", len(r.committed))
+	}
+	if calls != 3 || len(batches) != 2 || batches[0] != 2 || batches[1] != 1 {
+		t.Fatalf("unexpected webhook calls %d with batches %v", calls, batches)
+	}
+}
+
+func TestWebhookSinkPermanentError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	s := &webhookSink{
+		url:       server.URL,
+		client:    server.Client(),
+		batchSize: 10,
+		retries:   3,
+		backoff:   time.Millisecond,
+	}
+	r := &fakeReader{batches: [][]record{testRecords(1)}}
+	if err := pump(context.Background(), r, s); !errors.Is(err, errPermanent) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 1 || len(r.committed) != 0 {
+		t.Fatalf("unexpected webhook calls %d and commits %d", calls, len(r.committed))
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
+
+	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topictypes"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/cdc"
+)
+
+var (
+	dsn               string
+	targetDSN         string
+	useEnvCredentials bool
+	sourceTable       string
+	targetTable       string
+	changefeed        string
+	consumer          string
+	batchSize         int
+	reportInterval    time.Duration
+	restartDelay      time.Duration
+	metricsAddr       string
+)
+
+func main() {
+	readFlags()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	source := connect(ctx, dsn)
+	defer func() { _ = source.Close(ctx) }()
+	target := source
+	if targetDSN != "" {
+		target = connect(ctx, targetDSN)
+		defer func() { _ = target.Close(ctx) }()
+	}
+
+	sourcePath := fullPath(source, sourceTable)
+	targetPath := fullPath(target, targetTable)
+	topicPath := path.Join(sourcePath, changefeed)
+
+	description, err := describeTable(ctx, source, sourcePath)
+	if err != nil {
+		log.Fatalf("describe source table error: %v", err)
+	}
+	if err = createTableIfNotExists(ctx, target, targetPath, description); err != nil {
+		log.Fatalf("create target table error: %v", err)
+	}
+	if err = addConsumerIfNotExists(ctx, source, topicPath, consumer); err != nil {
+		log.Fatalf("add consumer error: %v", err)
+	}
+	decoder, err := cdc.NewDecoder[cdc.Row](description)
+	if err != nil {
+		log.Fatalf("create decoder error: %v", err)
+	}
+
+	registry := prometheus.NewRegistry()
+	m := newMetrics(registry)
+	if metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+			err := http.ListenAndServe(metricsAddr, mux)
+			log.Fatalf("serve metrics error: %v", err)
+		}()
+	}
+
+	r := newReplicator(target, targetPath, description)
+	for {
+		err = replicate(ctx, source, topicPath, decoder, r, m)
+		if ctx.Err() != nil {
+			return
+		}
+		// not committed events are read again by restarted reader, they are applied idempotently
+		log.Printf("replication failed, restart in %v: %v", restartDelay, err)
+		m.restarts.Inc()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// replicate reads changefeed by batches and applies them to target table. Offsets are committed only after
+// batch is written, so after restart replication resumes from the first not applied event.
+func replicate(
+	ctx context.Context,
+	source ydb.Connection,
+	topicPath string,
+	decoder *cdc.Decoder[cdc.Row],
+	r *replicator,
+	m *metrics,
+) error {
+	reader, err := source.Topic().StartReader(consumer, topicoptions.ReadTopic(topicPath),
+		topicoptions.WithBatchReadMaxCount(batchSize),
+	)
+	if err != nil {
+		return fmt.Errorf("start reader failed: %w", err)
+	}
+	defer func() { _ = reader.Close(context.Background()) }()
+
+	var (
+		applied    int
+		lag        time.Duration
+		reportedAt = time.Now()
+	)
+	log.Printf("Start replication of %s to %s", topicPath, r.targetPath)
+	for {
+		batch, err := reader.ReadMessageBatch(ctx)
+		if err != nil {
+			return fmt.Errorf("read failed: %w", err)
+		}
+		events := make([]cdc.Event[cdc.Row], len(batch.Messages))
+		for i, msg := range batch.Messages {
+			if events[i], err = decoder.DecodeMessage(msg); err != nil {
+				return fmt.Errorf("decode message with offset %d failed: %w", msg.Offset, err)
+			}
+		}
+		if err = r.apply(ctx, events); err != nil {
+			return err
+		}
+		if err = reader.Commit(ctx, batch); err != nil {
+			return fmt.Errorf("commit failed: %w", err)
+		}
+
+		applied += len(events)
+		if len(batch.Messages) > 0 {
+			lag = m.observe(len(events), batch.Messages[len(batch.Messages)-1].WrittenAt, time.Now())
+		}
+		if time.Since(reportedAt) >= reportInterval {
+			log.Printf("applied %d events, lag %v", applied, lag.Round(time.Millisecond))
+			applied, reportedAt = 0, time.Now()
+		}
+	}
+}
+
+func readFlags() {
+	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		_, _ = fmt.Fprintf(out, "Usage:\n%s [options]\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "\nOptions:\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.StringVar(&dsn,
+		"ydb", "grpc://localhost:2136/local",
+		"YDB connection string of source database",
+	)
+	flagSet.StringVar(&targetDSN,
+		"target-ydb", "",
+		"YDB connection string of target database, default is source database",
+	)
+	flagSet.BoolVar(&useEnvCredentials,
+		"use-env-credentials", false,
+		"Use credentials from env variables",
+	)
+	flagSet.StringVar(&sourceTable,
+		"table", "",
+		"source table path, relative to database if it is not absolute",
+	)
+	flagSet.StringVar(&changefeed,
+		"changefeed", "feed",
+		"changefeed name of source table",
+	)
+	flagSet.StringVar(&consumer,
+		"consumer", "replicator",
+		"changefeed consumer name, it is added if not exists",
+	)
+	flagSet.StringVar(&targetTable,
+		"target", "",
+		"target table path, relative to target database if it is not absolute, it is created if not exists",
+	)
+	flagSet.IntVar(&batchSize,
+		"batch-size", 1000,
+		"max count of events written to target table in one transaction",
+	)
+	flagSet.DurationVar(&reportInterval,
+		"report-interval", 10*time.Second,
+		"interval of replication progress and lag reports",
+	)
+	flagSet.DurationVar(&restartDelay,
+		"restart-delay", 5*time.Second,
+		"delay before restart of replication after error",
+	)
+	flagSet.StringVar(&metricsAddr,
+		"metrics-addr", "",
+		"address of prometheus metrics endpoint, metrics are not served if it is empty",
+	)
+	if err := flagSet.Parse(os.Args[1:]); err != nil {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if sourceTable == "" || targetTable == "" || batchSize < 1 {
+		_, _ = fmt.Fprintf(flagSet.Output(), "\n-table and -target are required, -batch-size must be positive\n\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+}
+
+func connect(ctx context.Context, dsn string) ydb.Connection {
+	var opts []ydb.Option
+	if useEnvCredentials {
+		opts = append(opts, environ.WithEnvironCredentials(ctx))
+	}
+	db, err := ydb.Open(ctx, dsn, opts...)
+	if err != nil {
+		log.Fatalf("connect error: %v", err)
+	}
+	return db
+}
+
+func fullPath(db ydb.Connection, p string) string {
+	if strings.HasPrefix(p, "/") {
+		return p
+	}
+	return path.Join(db.Name(), p)
+}
+
+func describeTable(ctx context.Context, db ydb.Connection, tablePath string) (description options.Description, err error) {
+	err = db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) (err error) {
+			description, err = s.DescribeTable(ctx, tablePath)
+			return err
+		},
+		table.WithIdempotent(),
+	)
+	return description, err
+}
+
+// createTableIfNotExists creates table with columns and primary key of source table
+func createTableIfNotExists(ctx context.Context, db ydb.Connection, tablePath string, source options.Description) error {
+	_, err := describeTable(ctx, db, tablePath)
+	if err == nil || !ydb.IsOperationErrorSchemeError(err) {
+		return err
+	}
+	opts := make([]options.CreateTableOption, 0, len(source.Columns)+1)
+	for _, c := range source.Columns {
+		opts = append(opts, options.WithColumn(c.Name, c.Type))
+	}
+	opts = append(opts, options.WithPrimaryKeyColumn(source.PrimaryKey...))
+	log.Printf("Create table %s", tablePath)
+	return db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) error {
+			return s.CreateTable(ctx, tablePath, opts...)
+		},
+		table.WithIdempotent(),
+	)
+}
+
+func addConsumerIfNotExists(ctx context.Context, db ydb.Connection, topicPath, name string) error {
+	description, err := db.Topic().Describe(ctx, topicPath)
+	if err != nil {
+		return err
+	}
+	for _, c := range description.Consumers {
+		if c.Name == name {
+			return nil
+		}
+	}
+	log.Printf("Add consumer %s to %s", name, topicPath)
+	return db.Topic().Alter(ctx, topicPath, topicoptions.AlterWithAddConsumers(topictypes.Consumer{
+		Name: name,
+	}))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics are replication progress metrics
+type metrics struct {
+	applied   prometheus.Counter
+	batches   prometheus.Counter
+	restarts  prometheus.Counter
+	lag       prometheus.Gauge
+	writtenAt prometheus.Gauge
+}
+
+func newMetrics(registerer prometheus.Registerer) *metrics {
+	m := &metrics{
+		applied: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "replicator",
+			Name:      "applied_events_total",
+			Help:      "Count of changefeed events applied to target table",
+		}),
+		batches: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "replicator",
+			Name:      "applied_batches_total",
+			Help:      "Count of batches applied to target table in one transaction",
+		}),
+		restarts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "replicator",
+			Name:      "restarts_total",
+			Help:      "Count of replication restarts after errors",
+		}),
+		lag: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "replicator",
+			Name:      "lag_seconds",
+			Help:      "Delay between write of the last applied event to changefeed and its applying",
+		}),
+		writtenAt: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "replicator",
+			Name:      "last_applied_written_timestamp_seconds",
+			Help: "Unix time of write of the last applied event to changefeed, " +
+				"time() minus it is a lag which grows also while replication is stuck",
+		}),
+	}
+	registerer.MustRegister(m.applied, m.batches, m.restarts, m.lag, m.writtenAt)
+	return m
+}
+
+// observe records batch of events applied at now, writtenAt is write time of the last event of batch
+func (m *metrics) observe(events int, writtenAt, now time.Time) time.Duration {
+	lag := now.Sub(writtenAt)
+	m.applied.Add(float64(events))
+	m.batches.Inc()
+	m.lag.Set(lag.Seconds())
+	m.writtenAt.Set(float64(writtenAt.UnixNano()) / float64(time.Second))
+	return lag
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/cdc"
+)
+
+// replicator applies changefeed events of source table to target table
+type replicator struct {
+	target     ydb.Connection
+	targetPath string
+	key        []string
+	columns    map[string]types.Type
+}
+
+func newReplicator(target ydb.Connection, targetPath string, source options.Description) *replicator {
+	r := &replicator{
+		target:     target,
+		targetPath: targetPath,
+		key:        source.PrimaryKey,
+		columns:    make(map[string]types.Type, len(source.Columns)),
+	}
+	for _, c := range source.Columns {
+		r.columns[c.Name] = c.Type
+	}
+	return r
+}
+
+// change is a result of all changes of one row in batch
+type change struct {
+	key cdc.Row
+	// erase is set if row is erased before upsert of values
+	erase bool
+	// values are upserted columns, nil if row is erased only
+	values cdc.Row
+}
+
+// collapse merges events of the same rows, so every row is changed once and in order of events
+func (r *replicator) collapse(events []cdc.Event[cdc.Row]) (changes []*change) {
+	byKey := make(map[string]*change, len(events))
+	for _, e := range events {
+		if e.Operation == cdc.OperationResolved {
+			continue
+		}
+		k := r.keyString(e.Key)
+		c, ok := byKey[k]
+		if !ok {
+			c = &change{key: e.Key}
+			byKey[k] = c
+			changes = append(changes, c)
+		}
+		if e.Operation == cdc.OperationErase {
+			c.erase, c.values = true, nil
+			continue
+		}
+		if c.values == nil {
+			c.values = make(cdc.Row, len(e.Columns))
+		}
+		for _, name := range e.Columns {
+			if v, ok := (*e.NewImage)[name]; ok {
+				c.values[name] = v
+			}
+		}
+	}
+	return changes
+}
+
+func (r *replicator) keyString(key cdc.Row) string {
+	parts := make([]string, len(r.key))
+	for i, name := range r.key {
+		parts[i] = key[name].Yql()
+	}
+	return strings.Join(parts, ",")
+}
+
+// apply writes events to target table in one transaction. Upsert and erase of rows are idempotent, so batch
+// may be applied again after failure.
+func (r *replicator) apply(ctx context.Context, events []cdc.Event[cdc.Row]) error {
+	query, params := r.query(r.collapse(events))
+	if query == "" {
+		return nil
+	}
+	err := r.target.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) error {
+			res, err := tx.Execute(ctx, query, params)
+			if err != nil {
+				return err
+			}
+			return res.Close()
+		},
+		table.WithIdempotent(),
+	)
+	if err != nil {
+		return fmt.Errorf("write to '%s' failed: %w", r.targetPath, err)
+	}
+	return nil
+}
+
+// query makes query which deletes erased rows and then upserts rows grouped by set of changed columns
+func (r *replicator) query(changes []*change) (string, *table.QueryParameters) {
+	var (
+		declares   strings.Builder
+		statements strings.Builder
+		params     []table.ParameterOption
+		erased     []types.Value
+		groups     = make(map[string][]*change)
+		signatures []string
+	)
+	for _, c := range changes {
+		if c.erase {
+			erased = append(erased, r.structValue(c.key, r.key))
+		}
+		if c.values == nil {
+			continue
+		}
+		signature := strings.Join(r.names(c), ",")
+		if _, ok := groups[signature]; !ok {
+			signatures = append(signatures, signature)
+		}
+		groups[signature] = append(groups[signature], c)
+	}
+	if len(erased) > 0 {
+		r.declare(&declares, "$erase", r.key)
+		fmt.Fprintf(&statements, "DELETE FROM `%s` ON SELECT * FROM AS_TABLE($erase);\n", r.targetPath)
+		params = append(params, table.ValueParam("$erase", types.ListValue(erased...)))
+	}
+	for i, signature := range signatures {
+		name := fmt.Sprintf("$upsert%d", i)
+		columns := strings.Split(signature, ",")
+		rows := make([]types.Value, len(groups[signature]))
+		for j, c := range groups[signature] {
+			row := make(cdc.Row, len(columns))
+			for k, v := range c.key {
+				row[k] = v
+			}
+			for k, v := range c.values {
+				row[k] = v
+			}
+			rows[j] = r.structValue(row, columns)
+		}
+		r.declare(&declares, name, columns)
+		fmt.Fprintf(&statements, "UPSERT INTO `%s` SELECT * FROM AS_TABLE(%s);\n", r.targetPath, name)
+		params = append(params, table.ValueParam(name, types.ListValue(rows...)))
+	}
+	if statements.Len() == 0 {
+		return "", nil
+	}
+	return declares.String() + "\n" + statements.String(), table.NewQueryParameters(params...)
+}
+
+// names returns sorted names of key and changed columns
+func (r *replicator) names(c *change) []string {
+	names := append([]string(nil), r.key...)
+	for name := range c.values {
+		if _, ok := c.key[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *replicator) declare(b *strings.Builder, name string, columns []string) {
+	fields := make([]types.StructOption, len(columns))
+	for i, column := range columns {
+		fields[i] = types.StructField(column, r.columns[column])
+	}
+	fmt.Fprintf(b, "DECLARE %s AS %s;\n", name, types.List(types.Struct(fields...)).Yql())
+}
+
+func (r *replicator) structValue(row cdc.Row, columns []string) types.Value {
+	fields := make([]types.StructValueOption, len(columns))
+	for i, column := range columns {
+		fields[i] = types.StructFieldValue(column, row[column])
+	}
+	return types.StructValue(fields...)
+}
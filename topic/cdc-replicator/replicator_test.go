@@ -0,0 +1,172 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/cdc"
+)
+
+func testReplicator() *replicator {
+	return newReplicator(nil, "/local/replica", options.Description{
+		Name: "items",
+		Columns: []options.Column{
+			{Name: "id", Type: types.TypeUint64},
+			{Name: "title", Type: types.Optional(types.TypeText)},
+			{Name: "volume", Type: types.Optional(types.TypeInt64)},
+		},
+		PrimaryKey: []string{"id"},
+	})
+}
+
+func key(id uint64) cdc.Row {
+	return cdc.Row{"id": types.Uint64Value(id)}
+}
+
+func upsert(id uint64, values cdc.Row) cdc.Event[cdc.Row] {
+	image := key(id)
+	e := cdc.Event[cdc.Row]{Operation: cdc.OperationUpsert, Key: key(id), NewImage: &image}
+	for name, v := range values {
+		image[name] = v
+		e.Columns = append(e.Columns, name)
+	}
+	return e
+}
+
+func erase(id uint64) cdc.Event[cdc.Row] {
+	return cdc.Event[cdc.Row]{Operation: cdc.OperationErase, Key: key(id)}
+}
+
+func title(s string) types.Value {
+	return types.OptionalValue(types.TextValue(s))
+}
+
+func volume(v int64) types.Value {
+	return types.OptionalValue(types.Int64Value(v))
+}
+
+// testEvents are events of batch: row 1 is upserted twice, row 2 is upserted and erased, row 3 is erased and
+// inserted again
+func testEvents() []cdc.Event[cdc.Row] {
+	return []cdc.Event[cdc.Row]{
+		upsert(1, cdc.Row{"title": title("a")}),
+		upsert(2, cdc.Row{"title": title("b")}),
+		{Operation: cdc.OperationResolved, Timestamp: []uint64{1, 2}},
+		upsert(1, cdc.Row{"volume": volume(5)}),
+		erase(2),
+		erase(3),
+		upsert(3, cdc.Row{"volume": volume(7)}),
+		upsert(1, cdc.Row{"volume": volume(6)}),
+	}
+}
+
+func TestCollapse(t *testing.T) {
+	changes := testReplicator().collapse(testEvents())
+	if len(changes) != 3 {
+		t.Fatalf("collapsed to %d changes, want 3", len(changes))
+	}
+	for i, expected := range []struct {
+		id     string
+		erase  bool
+		values map[string]string
+	}{
+		{id: "1ul", values: map[string]string{"title": title("a").Yql(), "volume": volume(6).Yql()}},
+		{id: "2ul", erase: true},
+		{id: "3ul", erase: true, values: map[string]string{"volume": volume(7).Yql()}},
+	} {
+		c := changes[i]
+		if id := c.key["id"].Yql(); id != expected.id {
+			t.Fatalf("change %d has key %s, want %s", i, id, expected.id)
+		}
+		if c.erase != expected.erase {
+			t.Fatalf("change %d erase is %v, want %v", i, c.erase, expected.erase)
+		}
+		if (c.values == nil) != (expected.values == nil) || len(c.values) != len(expected.values) {
+			t.Fatalf("change %d has values %v, want %v", i, c.values, expected.values)
+		}
+		for name, v := range expected.values {
+			if c.values[name] == nil || c.values[name].Yql() != v {
+				t.Fatalf("change %d has column '%s' %v, want %s", i, name, c.values[name], v)
+			}
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	r := testReplicator()
+	query, params := r.query(r.collapse(testEvents()))
+
+	expected := strings.Join([]string{
+		"DECLARE $erase AS List<Struct<'id':Uint64>>;",
+		"DECLARE $upsert0 AS List<Struct<'id':Uint64,'title':Optional<Utf8>,'volume':Optional<Int64>>>;",
+		"DECLARE $upsert1 AS List<Struct<'id':Uint64,'volume':Optional<Int64>>>;",
+		"",
+		"DELETE FROM `/local/replica` ON SELECT * FROM AS_TABLE($erase);",
+		"UPSERT INTO `/local/replica` SELECT * FROM AS_TABLE($upsert0);",
+		"UPSERT INTO `/local/replica` SELECT * FROM AS_TABLE($upsert1);",
+		"",
+	}, "\n")
+	if query != expected {
+		t.Fatalf("unexpected query:\n%s\nwant:\n%s", query, expected)
+	}
+
+	values := make(map[string]string)
+	params.Each(func(name string, v types.Value) {
+		values[name] = v.Yql()
+	})
+	for name, v := range map[string]types.Value{
+		"$erase": types.ListValue(
+			types.StructValue(types.StructFieldValue("id", types.Uint64Value(2))),
+			types.StructValue(types.StructFieldValue("id", types.Uint64Value(3))),
+		),
+		"$upsert0": types.ListValue(types.StructValue(
+			types.StructFieldValue("id", types.Uint64Value(1)),
+			types.StructFieldValue("title", title("a")),
+			types.StructFieldValue("volume", volume(6)),
+		)),
+		"$upsert1": types.ListValue(types.StructValue(
+			types.StructFieldValue("id", types.Uint64Value(3)),
+			types.StructFieldValue("volume", volume(7)),
+		)),
+	} {
+		if values[name] != v.Yql() {
+			t.Fatalf("parameter %s is %s, want %s", name, values[name], v.Yql())
+		}
+	}
+}
+
+func TestQueryOfResolvedOnly(t *testing.T) {
+	r := testReplicator()
+	query, _ := r.query(r.collapse([]cdc.Event[cdc.Row]{
+		{Operation: cdc.OperationResolved, Timestamp: []uint64{1, 2}},
+	}))
+	if query != "" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+}
+
+func TestMetricsObserve(t *testing.T) {
+	m := newMetrics(prometheus.NewRegistry())
+	writtenAt := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	lag := m.observe(10, writtenAt, writtenAt.Add(1500*time.Millisecond))
+	if lag != 1500*time.Millisecond {
+		t.Fatalf("unexpected lag: %v", lag)
+	}
+	m.observe(5, writtenAt, writtenAt.Add(2*time.Second))
+	if v := testutil.ToFloat64(m.applied); v != 15 {
+		t.Fatalf("applied %v events, want 15", v)
+	}
+	if v := testutil.ToFloat64(m.lag); v != 2 {
+		t.Fatalf("lag is %v seconds, want 2", v)
+	}
+	if v := testutil.ToFloat64(m.writtenAt); v != float64(writtenAt.Unix()) {
+		t.Fatalf("last applied event is written at %v, want %v", v, writtenAt.Unix())
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
+
+	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicwriter"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/dlq"
+)
+
+var (
+	dsn               string
+	useEnvCredentials bool
+	dlqTopic          string
+	consumer          string
+	target            string
+	producerID        string
+	limit             int
+	idleTimeout       time.Duration
+)
+
+func main() {
+	readFlags()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var opts []ydb.Option
+	if useEnvCredentials {
+		opts = append(opts, environ.WithEnvironCredentials(ctx))
+	}
+	db, err := ydb.Open(ctx, dsn, opts...)
+	if err != nil {
+		log.Fatalf("connect error: %v", err)
+	}
+	defer func() { _ = db.Close(ctx) }()
+
+	reader, err := db.Topic().StartReader(consumer, topicoptions.ReadTopic(dlqTopic),
+		topicoptions.WithCommitMode(topicoptions.CommitModeSync),
+	)
+	if err != nil {
+		log.Fatalf("start reader error: %v", err)
+	}
+	defer func() { _ = reader.Close(context.Background()) }()
+
+	r := &redriver{db: db, writers: make(map[writerKey]*topicwriter.Writer)}
+	defer r.close()
+
+	err = r.run(ctx, reader)
+	log.Printf("redrived %d messages", r.count)
+	if err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
+
+// writerKey identifies writer of messages from partition of dead-letter topic to target topic
+type writerKey struct {
+	topic     string
+	partition int64
+}
+
+// redriver writes original messages of letters back to topics. Sequence number of message is an offset of its
+// letter, and every partition of dead-letter topic has its own producer, so topic skips messages which are
+// written before redrive is interrupted and letters are read again.
+type redriver struct {
+	db      ydb.Connection
+	writers map[writerKey]*topicwriter.Writer
+	count   int
+}
+
+func (r *redriver) run(ctx context.Context, reader *topicreader.Reader) error {
+	for limit == 0 || r.count < limit {
+		var opts []topicreader.ReadBatchOption
+		if limit > 0 {
+			opts = append(opts, topicreader.WithBatchMaxCount(limit-r.count))
+		}
+		readCtx, cancel := context.WithTimeout(ctx, idleTimeout)
+		batch, err := reader.ReadMessageBatch(readCtx, opts...)
+		idle := readCtx.Err() != nil
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && idle {
+				return nil
+			}
+			return fmt.Errorf("read error: %w", err)
+		}
+		for _, msg := range batch.Messages {
+			if err = r.redrive(ctx, msg); err != nil {
+				return err
+			}
+		}
+		if err = reader.Commit(ctx, batch); err != nil {
+			return fmt.Errorf("commit error: %w", err)
+		}
+		r.count += len(batch.Messages)
+	}
+	return nil
+}
+
+func (r *redriver) redrive(ctx context.Context, msg *topicreader.Message) error {
+	data, err := io.ReadAll(msg)
+	if err != nil {
+		return fmt.Errorf("read letter %d error: %w", msg.Offset, err)
+	}
+	letter, err := dlq.Decode(data)
+	if err != nil {
+		return fmt.Errorf("letter %d: %w", msg.Offset, err)
+	}
+	topic := letter.Topic
+	if target != "" {
+		topic = target
+	}
+	w, err := r.writer(writerKey{topic: topic, partition: msg.PartitionID()})
+	if err != nil {
+		return err
+	}
+	err = w.Write(ctx, topicwriter.Message{
+		SeqNo:     msg.Offset + 1,
+		CreatedAt: letter.CreatedAt,
+		Data:      bytes.NewReader(letter.Data),
+	})
+	if err != nil {
+		return fmt.Errorf("write letter %d to %s error: %w", msg.Offset, topic, err)
+	}
+	log.Printf("redrived letter %d to %s, it was failed with: %s", msg.Offset, topic, letter.Error)
+	return nil
+}
+
+func (r *redriver) writer(key writerKey) (*topicwriter.Writer, error) {
+	if w, ok := r.writers[key]; ok {
+		return w, nil
+	}
+	// offsets of different dead-letter topics are not one sequence, so producer is unique per dead-letter topic
+	// and its partition. Original message group of letter can't be kept, because group must be equal to producer.
+	id := fmt.Sprintf("%s-%s-%d", producerID, dlqTopic, key.partition)
+	w, err := r.db.Topic().StartWriter(id, key.topic,
+		topicoptions.WithMessageGroupID(id),
+		topicoptions.WithWriterSetAutoSeqNo(false),
+		topicoptions.WithSyncWrite(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("start writer to %s error: %w", key.topic, err)
+	}
+	r.writers[key] = w
+	return w, nil
+}
+
+func (r *redriver) close() {
+	for _, w := range r.writers {
+		_ = w.Close(context.Background())
+	}
+}
+
+func readFlags() {
+	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		_, _ = fmt.Fprintf(out, "Usage:\n%s [options]\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "\nReplays messages of dead-letter topic back into their topics.\n")
+		_, _ = fmt.Fprintf(out, "\nOptions:\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.StringVar(&dsn,
+		"ydb", "grpc://localhost:2136/local",
+		"YDB connection string",
+	)
+	flagSet.BoolVar(&useEnvCredentials,
+		"use-env-credentials", false,
+		"Use credentials from env variables",
+	)
+	flagSet.StringVar(&dlqTopic,
+		"dlq", "",
+		"dead-letter topic path",
+	)
+	flagSet.StringVar(&consumer,
+		"consumer", "",
+		"consumer of dead-letter topic",
+	)
+	flagSet.StringVar(&target,
+		"target", "",
+		"topic path to which messages are replayed, default is the original topic of message",
+	)
+	flagSet.StringVar(&producerID,
+		"producer-id", "dlq-redrive",
+		"prefix of producer ids, dead-letter topic path and its partition are appended to it",
+	)
+	flagSet.IntVar(&limit,
+		"limit", 0,
+		"max count of replayed messages, 0 is unlimited",
+	)
+	flagSet.DurationVar(&idleTimeout,
+		"idle-timeout", 3*time.Second,
+		"time without letters after which redrive stops",
+	)
+	if err := flagSet.Parse(os.Args[1:]); err != nil {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if dlqTopic == "" || consumer == "" || limit < 0 {
+		_, _ = fmt.Fprintf(flagSet.Output(), "\n-dlq and -consumer are required, -limit must not be negative\n\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+}
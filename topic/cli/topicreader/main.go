@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
+
+	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+)
+
+var (
+	dsn               string
+	useEnvCredentials bool
+	consumer          string
+	selectors         selectorsFlag
+	start             string
+	offsets           = offsetsFlag{}
+	format            string
+	commit            bool
+	limit             int
+	follow            bool
+	idleTimeout       time.Duration
+)
+
+func main() {
+	readFlags()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	position, err := parseStart(start, time.Now())
+	if err != nil {
+		log.Fatal(err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer func() { _ = out.Flush() }()
+	p, err := newPrinter(out, format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var opts []ydb.Option
+	if useEnvCredentials {
+		opts = append(opts, environ.WithEnvironCredentials(ctx))
+	}
+	db, err := ydb.Open(ctx, dsn, opts...)
+	if err != nil {
+		log.Fatalf("connect error: %v", err)
+	}
+	defer func() { _ = db.Close(ctx) }()
+
+	reader, err := db.Topic().StartReader(consumer, readSelectors(position), readerOptions(position)...)
+	if err != nil {
+		log.Fatalf("start reader error: %v", err)
+	}
+	defer func() { _ = reader.Close(context.Background()) }()
+
+	n, err := read(ctx, reader, p, out)
+	log.Printf("read %d messages", n)
+	if err != nil && ctx.Err() == nil {
+		_ = out.Flush()
+		log.Fatal(err)
+	}
+}
+
+// readSelectors returns selectors with start time of reading
+func readSelectors(position startPosition) topicoptions.ReadSelectors {
+	result := make(topicoptions.ReadSelectors, len(selectors))
+	for i, s := range selectors {
+		result[i] = s
+		result[i].ReadFrom = position.from
+	}
+	return result
+}
+
+func readerOptions(position startPosition) []topicoptions.ReaderOption {
+	opts := []topicoptions.ReaderOption{topicoptions.WithCommitMode(topicoptions.CommitModeNone)}
+	if commit {
+		opts[0] = topicoptions.WithCommitMode(topicoptions.CommitModeSync)
+	}
+	if len(offsets) > 0 || position.earliest {
+		opts = append(opts, topicoptions.WithGetPartitionStartOffset(
+			func(
+				ctx context.Context,
+				req topicoptions.GetPartitionStartOffsetRequest,
+			) (
+				res topicoptions.GetPartitionStartOffsetResponse,
+				err error,
+			) {
+				if offset, ok := offsets[req.PartitionID]; ok {
+					res.StartFrom(offset)
+				} else if position.earliest {
+					res.StartFrom(0)
+				}
+				return res, nil
+			},
+		))
+	}
+	return opts
+}
+
+// read prints messages until limit is reached. Without follow it stops when no messages are received for
+// idle timeout, so it reads messages which are in topic and exits.
+func read(ctx context.Context, reader *topicreader.Reader, p printer, out *bufio.Writer) (n int, err error) {
+	for limit == 0 || n < limit {
+		var opts []topicreader.ReadBatchOption
+		if limit > 0 {
+			opts = append(opts, topicreader.WithBatchMaxCount(limit-n))
+		}
+		batch, err := readBatch(ctx, reader, opts...)
+		if errors.Is(err, errIdle) {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("read error: %w", err)
+		}
+		for _, msg := range batch.Messages {
+			data, err := io.ReadAll(msg)
+			if err != nil {
+				return n, fmt.Errorf("read message data error: %w", err)
+			}
+			err = p.Print(&message{
+				Topic:          msg.Topic(),
+				Partition:      msg.PartitionID(),
+				Offset:         msg.Offset,
+				SeqNo:          msg.SeqNo,
+				CreatedAt:      msg.CreatedAt,
+				WrittenAt:      msg.WrittenAt,
+				MessageGroupID: msg.MessageGroupID,
+				ProducerID:     msg.ProducerID,
+				Data:           data,
+			})
+			if err != nil {
+				return n, fmt.Errorf("print error: %w", err)
+			}
+			n++
+		}
+		if err = out.Flush(); err != nil {
+			return n, fmt.Errorf("print error: %w", err)
+		}
+		if commit {
+			if err = reader.Commit(ctx, batch); err != nil {
+				return n, fmt.Errorf("commit error: %w", err)
+			}
+		}
+	}
+	return n, nil
+}
+
+var errIdle = errors.New("no messages for idle timeout")
+
+// readBatch reads batch of messages, without follow it returns errIdle if no messages are received for idle timeout
+func readBatch(
+	ctx context.Context, reader *topicreader.Reader, opts ...topicreader.ReadBatchOption,
+) (*topicreader.Batch, error) {
+	if follow {
+		return reader.ReadMessageBatch(ctx, opts...)
+	}
+	readCtx, cancel := context.WithTimeout(ctx, idleTimeout)
+	defer cancel()
+	batch, err := reader.ReadMessageBatch(readCtx, opts...)
+	if err != nil && ctx.Err() == nil && readCtx.Err() != nil {
+		return nil, errIdle
+	}
+	return batch, err
+}
+
+func readFlags() {
+	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		_, _ = fmt.Fprintf(out, "Usage:\n%s [options]\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "\nPrints messages of topics to stdout.\n")
+		_, _ = fmt.Fprintf(out, "\nOptions:\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.StringVar(&dsn,
+		"ydb", "grpc://localhost:2136/local",
+		"YDB connection string",
+	)
+	flagSet.BoolVar(&useEnvCredentials,
+		"use-env-credentials", false,
+		"Use credentials from env variables",
+	)
+	flagSet.StringVar(&consumer,
+		"consumer", "",
+		"consumer name",
+	)
+	flagSet.Var(&selectors,
+		"topic",
+		"topic path with optional list of partitions: path[:partition,partition...], may be repeated",
+	)
+	flagSet.StringVar(&start,
+		"start", "committed",
+		"start position of reading: committed, earliest, latest or RFC 3339 timestamp of writing",
+	)
+	flagSet.Var(offsets,
+		"offsets",
+		"start offsets of partitions: partition=offset[,partition=offset...], they override -start",
+	)
+	flagSet.StringVar(&format,
+		"format", "json",
+		"output format: raw (data only), json or hex (with metadata)",
+	)
+	flagSet.BoolVar(&commit,
+		"commit", false,
+		"commit read messages",
+	)
+	flagSet.IntVar(&limit,
+		"limit", 0,
+		"max count of read messages, 0 is unlimited",
+	)
+	flagSet.BoolVar(&follow,
+		"follow", false,
+		"wait new messages, otherwise reading stops when no messages are received for -idle-timeout",
+	)
+	flagSet.DurationVar(&idleTimeout,
+		"idle-timeout", 3*time.Second,
+		"time without messages after which reading stops if -follow is not set",
+	)
+	if err := flagSet.Parse(os.Args[1:]); err != nil {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if consumer == "" || len(selectors) == 0 || limit < 0 {
+		_, _ = fmt.Fprintf(flagSet.Output(), "\n-consumer and -topic are required, -limit must not be negative\n\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+}
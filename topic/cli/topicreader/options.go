@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+)
+
+// selectorsFlag is a list of topic selectors in form path[:partition,partition...]
+type selectorsFlag []topicoptions.ReadSelector
+
+func (f *selectorsFlag) String() string {
+	parts := make([]string, len(*f))
+	for i, s := range *f {
+		parts[i] = s.Path
+		if len(s.Partitions) > 0 {
+			partitions := make([]string, len(s.Partitions))
+			for j, p := range s.Partitions {
+				partitions[j] = strconv.FormatInt(p, 10)
+			}
+			parts[i] += ":" + strings.Join(partitions, ",")
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f *selectorsFlag) Set(value string) error {
+	topicPath, partitions, found := strings.Cut(value, ":")
+	if topicPath == "" {
+		return fmt.Errorf("empty topic path")
+	}
+	selector := topicoptions.ReadSelector{Path: topicPath}
+	if found {
+		for _, p := range strings.Split(partitions, ",") {
+			id, err := strconv.ParseInt(p, 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad partition '%s' of topic '%s'", p, topicPath)
+			}
+			selector.Partitions = append(selector.Partitions, id)
+		}
+	}
+	*f = append(*f, selector)
+	return nil
+}
+
+// offsetsFlag is a map of start offsets by partitions in form partition=offset[,partition=offset...]
+type offsetsFlag map[int64]int64
+
+func (f offsetsFlag) String() string {
+	parts := make([]string, 0, len(f))
+	for partition, offset := range f {
+		parts = append(parts, fmt.Sprintf("%d=%d", partition, offset))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f offsetsFlag) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		p, o, found := strings.Cut(part, "=")
+		partition, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || !found {
+			return fmt.Errorf("bad partition offset '%s'", part)
+		}
+		offset, err := strconv.ParseInt(o, 10, 64)
+		if err != nil || offset < 0 {
+			return fmt.Errorf("bad partition offset '%s'", part)
+		}
+		f[partition] = offset
+	}
+	return nil
+}
+
+// startPosition is a position of reading of partitions without explicit offsets
+type startPosition struct {
+	// committed is set if reading starts from committed offsets of consumer
+	committed bool
+	// earliest is set if reading starts from the first message in partition
+	earliest bool
+	// from is a write time of the first read message, it is used for latest and timestamp positions
+	from time.Time
+}
+
+// parseStart parses start position: committed, earliest, latest or RFC 3339 timestamp
+func parseStart(value string, now time.Time) (startPosition, error) {
+	switch value {
+	case "committed":
+		return startPosition{committed: true}, nil
+	case "earliest":
+		return startPosition{earliest: true}, nil
+	case "latest":
+		return startPosition{from: now}, nil
+	default:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return startPosition{}, fmt.Errorf("start must be committed, earliest, latest or RFC 3339 timestamp: %w", err)
+		}
+		return startPosition{from: t}, nil
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectorsFlag(t *testing.T) {
+	var f selectorsFlag
+	for _, v := range []string{"first", "/local/second:0,2"} {
+		if err := f.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(f) != 2 || f[0].Path != "first" || len(f[0].Partitions) != 0 ||
+		f[1].Path != "/local/second" || len(f[1].Partitions) != 2 || f[1].Partitions[1] != 2 {
+		t.Fatalf("unexpected selectors %+v", f)
+	}
+	if f.String() != "first /local/second:0,2" {
+		t.Fatalf("unexpected string %q", f.String())
+	}
+	for _, v := range []string{"", ":1", "topic:", "topic:a"} {
+		if err := f.Set(v); err == nil {
+			t.Fatalf("no error for %q", v)
+		}
+	}
+}
+
+func TestOffsetsFlag(t *testing.T) {
+	f := offsetsFlag{}
+	if err := f.Set("0=10,3=0"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f) != 2 || f[0] != 10 || f[3] != 0 {
+		t.Fatalf("unexpected offsets %v", f)
+	}
+	for _, v := range []string{"1", "1=", "a=1", "1=-1"} {
+		if err := f.Set(v); err == nil {
+			t.Fatalf("no error for %q", v)
+		}
+	}
+}
+
+func TestParseStart(t *testing.T) {
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := map[string]startPosition{
+		"committed":            {committed: true},
+		"earliest":             {earliest: true},
+		"latest":               {from: now},
+		"2022-12-31T10:00:00Z": {from: time.Date(2022, 12, 31, 10, 0, 0, 0, time.UTC)},
+	}
+	for value, want := range tests {
+		got, err := parseStart(value, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.committed != want.committed || got.earliest != want.earliest || !got.from.Equal(want.from) {
+			t.Fatalf("parseStart(%q) = %+v, want %+v", value, got, want)
+		}
+	}
+	if _, err := parseStart("yesterday", now); err == nil {
+		t.Fatal("no error for bad start")
+	}
+}
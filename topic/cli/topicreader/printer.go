@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// message is a read message with its metadata
+type message struct {
+	Topic          string    `json:"topic"`
+	Partition      int64     `json:"partition"`
+	Offset         int64     `json:"offset"`
+	SeqNo          int64     `json:"seq_no"`
+	CreatedAt      time.Time `json:"created_at"`
+	WrittenAt      time.Time `json:"written_at"`
+	MessageGroupID string    `json:"message_group_id"`
+	ProducerID     string    `json:"producer_id"`
+	Data           []byte    `json:"-"`
+}
+
+// printer writes messages to output in one of formats
+type printer interface {
+	Print(m *message) error
+}
+
+func newPrinter(w io.Writer, format string) (printer, error) {
+	switch format {
+	case "raw":
+		return &rawPrinter{w: w}, nil
+	case "json":
+		return &jsonPrinter{encoder: json.NewEncoder(w)}, nil
+	case "hex":
+		return &hexPrinter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format '%s'", format)
+	}
+}
+
+// rawPrinter writes data of message followed by line end
+type rawPrinter struct {
+	w io.Writer
+}
+
+func (p *rawPrinter) Print(m *message) error {
+	if _, err := p.w.Write(m.Data); err != nil {
+		return err
+	}
+	_, err := io.WriteString(p.w, "\n")
+	return err
+}
+
+// jsonPrinter writes JSON object of message per line, data which is not valid UTF-8 is encoded by base64
+type jsonPrinter struct {
+	encoder *json.Encoder
+}
+
+func (p *jsonPrinter) Print(m *message) error {
+	v := struct {
+		*message
+		Data       *string `json:"data,omitempty"`
+		DataBase64 []byte  `json:"data_base64,omitempty"`
+	}{message: m}
+	if utf8.Valid(m.Data) {
+		s := string(m.Data)
+		v.Data = &s
+	} else {
+		v.DataBase64 = m.Data
+	}
+	return p.encoder.Encode(v)
+}
+
+// hexPrinter writes metadata line and hex dump of message data
+type hexPrinter struct {
+	w io.Writer
+}
+
+func (p *hexPrinter) Print(m *message) error {
+	_, err := fmt.Fprintf(p.w, "%s partition: %d offset: %d seq no: %d created: %s written: %s group: %q producer: %q size: %d\n%s",
+		m.Topic, m.Partition, m.Offset, m.SeqNo,
+		m.CreatedAt.Format(time.RFC3339Nano), m.WrittenAt.Format(time.RFC3339Nano),
+		m.MessageGroupID, m.ProducerID, len(m.Data), hex.Dump(m.Data),
+	)
+	return err
+}
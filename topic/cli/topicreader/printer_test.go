@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMessage(data string) *message {
+	return &message{
+		Topic:          "/local/topic",
+		Partition:      1,
+		Offset:         42,
+		SeqNo:          7,
+		CreatedAt:      time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		WrittenAt:      time.Date(2023, 1, 1, 0, 0, 1, 0, time.UTC),
+		MessageGroupID: "group",
+		ProducerID:     "producer",
+		Data:           []byte(data),
+	}
+}
+
+func printMessage(t *testing.T, format string, m *message) string {
+	t.Helper()
+	var buf bytes.Buffer
+	p, err := newPrinter(&buf, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Print(m); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestRawPrinter(t *testing.T) {
+	if got := printMessage(t, "raw", testMessage("hello")); got != "hello\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
+
+func TestJSONPrinter(t *testing.T) {
+	want := `{"topic":"/local/topic","partition":1,"offset":42,"seq_no":7,` +
+		`"created_at":"2023-01-01T00:00:00Z","written_at":"2023-01-01T00:00:01Z",` +
+		`"message_group_id":"group","producer_id":"producer","data":"hello"}` + "\n"
+	if got := printMessage(t, "json", testMessage("hello")); got != want {
+		t.Fatalf("unexpected output %q", got)
+	}
+	if got := printMessage(t, "json", testMessage("\xff\x00")); !strings.Contains(got, `"data_base64":"/wA="`) ||
+		strings.Contains(got, `"data":`) {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
+
+func TestHexPrinter(t *testing.T) {
+	got := printMessage(t, "hex", testMessage("hi"))
+	want := `/local/topic partition: 1 offset: 42 seq no: 7 created: 2023-01-01T00:00:00Z ` +
+		`written: 2023-01-01T00:00:01Z group: "group" producer: "producer" size: 2` + "\n" +
+		"00000000  68 69                                             |hi|\n"
+	if got != want {
+		t.Fatalf("unexpected output %q", got)
+	}
+	if _, err := newPrinter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Fatal("no error for unknown format")
+	}
+}
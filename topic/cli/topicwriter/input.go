@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const maxMessageSize = 64 << 20
+
+// messageReader reads payloads of messages from input stream
+type messageReader interface {
+	// Next returns payload of next message or io.EOF after the last message
+	Next() ([]byte, error)
+}
+
+// input is a message payload or error of reading
+type input struct {
+	data []byte
+	err  error
+}
+
+// readInput reads messages in goroutine until error or io.EOF, so waiting for input (e.g. on terminal) doesn't
+// block cancel. Reading goroutine stops after ctx is done, but it may stay blocked in reading until input ends.
+func readInput(ctx context.Context, messages messageReader) <-chan input {
+	inputs := make(chan input)
+	go func() {
+		for {
+			data, err := messages.Next()
+			select {
+			case inputs <- input{data: data, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return inputs
+}
+
+func newMessageReader(r io.Reader, format string) (messageReader, error) {
+	switch format {
+	case "lines":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64<<10), maxMessageSize)
+		return &lineReader{scanner: scanner}, nil
+	case "delimited":
+		return &delimitedReader{r: bufio.NewReader(r)}, nil
+	default:
+		return nil, fmt.Errorf("unknown input format '%s'", format)
+	}
+}
+
+// lineReader reads a message from every line, line ends are not included in messages
+type lineReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *lineReader) Next() ([]byte, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return append([]byte(nil), r.scanner.Bytes()...), nil
+}
+
+// delimitedReader reads messages prefixed by varint encoded length, like delimited protobuf messages
+type delimitedReader struct {
+	r *bufio.Reader
+}
+
+func (r *delimitedReader) Next() ([]byte, error) {
+	size, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message size %d exceeds limit %d", size, maxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(r.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
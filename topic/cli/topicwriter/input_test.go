@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, r messageReader) (messages []string, err error) {
+	t.Helper()
+	for {
+		data, err := r.Next()
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, string(data))
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	r, err := newMessageReader(strings.NewReader("first\n\nthird\r\nlast"), "lines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := readAll(t, r)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"first", "", "third", "last"}
+	if strings.Join(messages, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", messages, want)
+	}
+}
+
+func TestDelimitedReader(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		size [binary.MaxVarintLen64]byte
+	)
+	for _, m := range []string{"a", "", strings.Repeat("x", 300)} {
+		buf.Write(size[:binary.PutUvarint(size[:], uint64(len(m)))])
+		buf.WriteString(m)
+	}
+	r, err := newMessageReader(bytes.NewReader(buf.Bytes()), "delimited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages, err := readAll(t, r)
+	if !errors.Is(err, io.EOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 3 || messages[0] != "a" || messages[1] != "" || len(messages[2]) != 300 {
+		t.Fatalf("unexpected messages %q", messages)
+	}
+
+	r, _ = newMessageReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]), "delimited")
+	if _, err = readAll(t, r); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error for truncated input: %v", err)
+	}
+}
+
+func TestReadInputCanceledWhileBlocked(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer func() { _ = pw.Close() }()
+	r, err := newMessageReader(pr, "lines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	inputs := readInput(ctx, r)
+
+	go func() { _, _ = io.WriteString(pw, "a\n") }()
+	if in := <-inputs; in.err != nil || string(in.data) != "a" {
+		t.Fatalf("unexpected input: %q, %v", in.data, in.err)
+	}
+
+	// reader is blocked without input, cancel must not wait for it
+	cancel()
+	select {
+	case in := <-inputs:
+		t.Fatalf("unexpected input after cancel: %q, %v", in.data, in.err)
+	case <-ctx.Done():
+	}
+}
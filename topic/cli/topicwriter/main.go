@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
+
+	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topictypes"
+)
+
+// closeTimeout limits acknowledgement of pending messages on exit
+const closeTimeout = time.Minute
+
+var (
+	dsn               string
+	useEnvCredentials bool
+	topicPath         string
+	producerID        string
+	groupID           string
+	codecName         string
+	format            string
+	syncWrite         bool
+	batchSize         int
+	maxPending        int
+	reportInterval    time.Duration
+	files             []string
+)
+
+var codecs = map[string]topictypes.Codec{
+	"raw":  topictypes.CodecRaw,
+	"gzip": topictypes.CodecGzip,
+}
+
+func main() {
+	readFlags()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		// the second signal kills process while pending messages are acknowledged
+		<-ctx.Done()
+		cancel()
+	}()
+
+	var opts []ydb.Option
+	if useEnvCredentials {
+		opts = append(opts, environ.WithEnvironCredentials(ctx))
+	}
+	db, err := ydb.Open(ctx, dsn, opts...)
+	if err != nil {
+		log.Fatalf("connect error: %v", err)
+	}
+	defer func() { _ = db.Close(context.Background()) }()
+
+	if !strings.HasPrefix(topicPath, "/") {
+		topicPath = path.Join(db.Name(), topicPath)
+	}
+	p := &producer{
+		db:         db,
+		topicPath:  topicPath,
+		producerID: producerID,
+		groupID:    groupID,
+		codec:      codecs[codecName],
+		sync:       syncWrite,
+		maxPending: maxPending,
+	}
+	if err = p.open(ctx); err != nil {
+		log.Fatalf("open writer error: %v", err)
+	}
+	log.Printf("write to %s as producer %s after seq no %d", topicPath, producerID, p.ackedSeqNo)
+
+	if err = run(ctx, p); err != nil {
+		log.Printf("write error: %v", err)
+		_ = db.Close(context.Background())
+		os.Exit(1)
+	}
+}
+
+// run writes messages from files of command line arguments or stdin
+func run(ctx context.Context, p *producer) error {
+	names := files
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	start := time.Now()
+	r := &reporter{start: start, reportedAt: start}
+	for _, name := range names {
+		if err := writeFile(ctx, p, name, r); err != nil {
+			if ctx.Err() == nil {
+				return err
+			}
+			break
+		}
+	}
+	// written messages are acknowledged on interrupt too, so close doesn't depend on ctx
+	stage := "done"
+	if ctx.Err() != nil {
+		stage = "interrupted"
+	}
+	closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if err := p.close(closeCtx); err != nil {
+		return fmt.Errorf("close writer error: %w", err)
+	}
+	r.report(p, stage)
+	return nil
+}
+
+func writeFile(ctx context.Context, p *producer, name string, r *reporter) error {
+	f := os.Stdin
+	if name != "-" {
+		var err error
+		if f, err = os.Open(name); err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+	}
+	messages, err := newMessageReader(f, format)
+	if err != nil {
+		return err
+	}
+	batch := make([][]byte, 0, batchSize)
+	inputs := readInput(ctx, messages)
+	for {
+		var in input
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case in = <-inputs:
+		}
+		data, err := in.data, in.err
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read %s failed: %w", name, err)
+		}
+		if data != nil {
+			batch = append(batch, data)
+		}
+		if len(batch) > 0 && (len(batch) == batchSize || err != nil) {
+			if err := p.write(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+			if time.Since(r.reportedAt) >= reportInterval {
+				r.report(p, "progress")
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// reporter logs throughput and acknowledged sequence numbers
+type reporter struct {
+	start      time.Time
+	reportedAt time.Time
+	messages   int
+	bytes      int
+}
+
+func (r *reporter) report(p *producer, stage string) {
+	now := time.Now()
+	elapsed := now.Sub(r.reportedAt).Seconds()
+	if stage != "progress" {
+		elapsed = now.Sub(r.start).Seconds()
+		r.messages, r.bytes = 0, 0
+	}
+	log.Printf("%s: written %d messages (%.1f msg/s, %.1f KiB/s), last seq no %d, acknowledged seq no %d",
+		stage, p.messages,
+		float64(p.messages-r.messages)/elapsed, float64(p.bytes-r.bytes)/1024/elapsed,
+		p.lastSeqNo, p.ackedSeqNo,
+	)
+	r.reportedAt, r.messages, r.bytes = now, p.messages, p.bytes
+}
+
+func readFlags() {
+	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		_, _ = fmt.Fprintf(out, "Usage:\n%s [options] [file...]\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "\nWrites messages from files or stdin to topic.\n")
+		_, _ = fmt.Fprintf(out, "\nOptions:\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.StringVar(&dsn,
+		"ydb", "grpc://localhost:2136/local",
+		"YDB connection string",
+	)
+	flagSet.BoolVar(&useEnvCredentials,
+		"use-env-credentials", false,
+		"Use credentials from env variables",
+	)
+	flagSet.StringVar(&topicPath,
+		"topic", "",
+		"topic path, relative to database if it is not absolute",
+	)
+	flagSet.StringVar(&producerID,
+		"producer-id", "topicwriter",
+		"producer id, topic deduplicates messages by producer id and sequence number",
+	)
+	flagSet.StringVar(&groupID,
+		"group-id", "",
+		"message group id, default is producer id",
+	)
+	flagSet.StringVar(&codecName,
+		"codec", "raw",
+		"codec of messages: raw or gzip",
+	)
+	flagSet.StringVar(&format,
+		"format", "lines",
+		"format of input: lines (message per line) or delimited (messages prefixed by varint length)",
+	)
+	flagSet.BoolVar(&syncWrite,
+		"sync", false,
+		"wait acknowledgement of every batch",
+	)
+	flagSet.IntVar(&batchSize,
+		"batch-size", 100,
+		"max count of messages written at once",
+	)
+	flagSet.IntVar(&maxPending,
+		"max-pending", 100000,
+		"max count of not acknowledged messages in async mode, writer waits acknowledgements when it is reached",
+	)
+	flagSet.DurationVar(&reportInterval,
+		"report-interval", 5*time.Second,
+		"interval of throughput reports",
+	)
+	if err := flagSet.Parse(os.Args[1:]); err != nil {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	files = flagSet.Args()
+	if groupID == "" {
+		groupID = producerID
+	}
+	if _, ok := codecs[codecName]; !ok || topicPath == "" || batchSize < 1 || maxPending < batchSize {
+		_, _ = fmt.Fprintf(flagSet.Output(),
+			"\n-topic is required, -codec must be raw or gzip, -max-pending must be not less than -batch-size\n\n",
+		)
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if format != "lines" && format != "delimited" {
+		_, _ = fmt.Fprintf(flagSet.Output(), "\n-format must be lines or delimited\n\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topictypes"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicwriter"
+)
+
+// pendingMessage is a message written in async mode and not acknowledged yet
+type pendingMessage struct {
+	seqNo int64
+	data  []byte
+}
+
+// producer writes messages with sequence numbers which writer assigns after the last sequence number of producer
+// in topic. Writer doesn't report acknowledgements in async mode (neither by result of Write nor by trace
+// callbacks), so written messages are kept until checkpoint. On checkpoint writer is reconnected, messages up to
+// the last sequence number received from server are acknowledged, and messages after it are written again with
+// the same sequence numbers. So in async mode acknowledged sequence number is updated only every maxPending
+// messages and lags behind the actual acknowledgements of server between checkpoints.
+type producer struct {
+	db         ydb.Connection
+	topicPath  string
+	producerID string
+	groupID    string
+	codec      topictypes.Codec
+	sync       bool
+	maxPending int
+
+	writer *topicwriter.Writer
+	// lastSeqNo is the sequence number of the last written message
+	lastSeqNo int64
+	// ackedSeqNo is the sequence number of the last acknowledged message
+	ackedSeqNo int64
+	pending    []pendingMessage
+
+	messages int
+	bytes    int
+}
+
+// open starts writer and waits for the last sequence number of producer
+func (p *producer) open(ctx context.Context) error {
+	connected := make(chan int64, 1)
+	writer, err := p.db.Topic().StartWriter(p.producerID, p.topicPath,
+		topicoptions.WithMessageGroupID(p.groupID),
+		topicoptions.WithCodec(p.codec),
+		topicoptions.WithSyncWrite(p.sync),
+		topicoptions.WithOnWriterFirstConnected(func(info topicoptions.WithOnWriterConnectedInfo) error {
+			connected <- info.LastSeqNo
+			return nil
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("start writer failed: %w", err)
+	}
+	select {
+	case <-ctx.Done():
+		_ = writer.Close(context.Background())
+		return ctx.Err()
+	case p.ackedSeqNo = <-connected:
+	}
+	p.writer = writer
+	p.lastSeqNo = p.ackedSeqNo
+	return nil
+}
+
+// write writes batch of messages, in sync mode it returns after acknowledgement of messages
+func (p *producer) write(ctx context.Context, batch [][]byte) error {
+	messages := make([]topicwriter.Message, len(batch))
+	for i, data := range batch {
+		p.lastSeqNo++
+		messages[i] = topicwriter.Message{Data: bytes.NewReader(data)}
+		if !p.sync {
+			p.pending = append(p.pending, pendingMessage{seqNo: p.lastSeqNo, data: data})
+		}
+		p.bytes += len(data)
+	}
+	if err := p.writer.Write(ctx, messages...); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	p.messages += len(batch)
+	if p.sync {
+		p.ackedSeqNo = p.lastSeqNo
+		return nil
+	}
+	if len(p.pending) >= p.maxPending {
+		return p.checkpoint(ctx)
+	}
+	return nil
+}
+
+// checkpoint waits acknowledgement of all pending messages, messages which are lost on reconnect are written again
+func (p *producer) checkpoint(ctx context.Context) error {
+	for len(p.pending) > 0 {
+		if err := p.writer.Close(ctx); err != nil {
+			log.Printf("close writer: %v", err)
+		}
+		if err := p.open(ctx); err != nil {
+			return err
+		}
+		i := 0
+		for i < len(p.pending) && p.pending[i].seqNo <= p.ackedSeqNo {
+			i++
+		}
+		p.pending = p.pending[i:]
+		if len(p.pending) == 0 {
+			break
+		}
+		log.Printf("rewrite %d not acknowledged messages after seq no %d", len(p.pending), p.ackedSeqNo)
+		messages := make([]topicwriter.Message, len(p.pending))
+		for i, m := range p.pending {
+			messages[i] = topicwriter.Message{Data: bytes.NewReader(m.data)}
+			p.lastSeqNo = m.seqNo
+		}
+		if err := p.writer.Write(ctx, messages...); err != nil {
+			return fmt.Errorf("rewrite failed: %w", err)
+		}
+	}
+	p.pending = nil
+	return nil
+}
+
+// close acknowledges pending messages and closes writer
+func (p *producer) close(ctx context.Context) error {
+	if err := p.checkpoint(ctx); err != nil {
+		return err
+	}
+	return p.writer.Close(ctx)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	environ "github.com/ydb-platform/ydb-go-sdk-auth-environ"
+
+	ydb "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topictypes"
+
+	"github.com/ydb-platform/ydb-go-examples/internal/dlq"
+)
+
+var (
+	dsn               string
+	useEnvCredentials bool
+	mode              string
+	topicName         string
+	consumerName      string
+	producerID        string
+	batchSize         int
+	pollInterval      time.Duration
+	orderInterval     time.Duration
+)
+
+func main() {
+	readFlags()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var opts []ydb.Option
+	if useEnvCredentials {
+		opts = append(opts, environ.WithEnvironCredentials(ctx))
+	}
+	db, err := ydb.Open(ctx, dsn, opts...)
+	if err != nil {
+		panic(fmt.Errorf("connect error: %w", err))
+	}
+	defer func() { _ = db.Close(ctx) }()
+
+	prefix := db.Name()
+	topicPath := path.Join(prefix, topicName)
+
+	if mode == "demo" {
+		prepare(ctx, db, prefix, topicPath)
+		go createOrders(ctx, db, prefix)
+		go readEvents(ctx, db, topicPath)
+	}
+
+	r, err := newRelay(db, prefix, topicPath, producerID, batchSize)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = r.Close(context.Background()) }()
+
+	log.Printf("Start relay of outbox to %s", topicPath)
+	if err = r.run(ctx, pollInterval); err != nil && ctx.Err() == nil {
+		panic(fmt.Errorf("relay error: %w", err))
+	}
+}
+
+func readFlags() {
+	flagSet := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flagSet.Usage = func() {
+		out := flagSet.Output()
+		_, _ = fmt.Fprintf(out, "Usage:\n%s [options]\n", os.Args[0])
+		_, _ = fmt.Fprintf(out, "\nOptions:\n")
+		flagSet.PrintDefaults()
+	}
+	flagSet.StringVar(&dsn,
+		"ydb", "grpc://localhost:2136/local",
+		"YDB connection string",
+	)
+	flagSet.BoolVar(&useEnvCredentials,
+		"use-env-credentials", false,
+		"Use credentials from env variables",
+	)
+	flagSet.StringVar(&mode,
+		"mode", "demo",
+		"demo: recreate tables and topic, create orders, relay and print events; relay: relay outbox only",
+	)
+	flagSet.StringVar(&topicName,
+		"topic", "order-events",
+		"topic of events, relative to database",
+	)
+	flagSet.StringVar(&consumerName,
+		"consumer", "outbox-consumer",
+		"consumer which prints events in demo mode",
+	)
+	flagSet.StringVar(&producerID,
+		"producer-id", "outbox-relay",
+		"producer id of relay, topic deduplicates messages by producer id and sequence number",
+	)
+	flagSet.IntVar(&batchSize,
+		"batch-size", 100,
+		"max count of events published at once",
+	)
+	flagSet.DurationVar(&pollInterval,
+		"poll-interval", time.Second,
+		"interval of outbox polling while it has no unsent events",
+	)
+	flagSet.DurationVar(&orderInterval,
+		"order-interval", 500*time.Millisecond,
+		"interval of order creation in demo mode",
+	)
+	if err := flagSet.Parse(os.Args[1:]); err != nil {
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if mode != "demo" && mode != "relay" || batchSize < 1 {
+		_, _ = fmt.Fprintf(flagSet.Output(), "\n-mode must be demo or relay, -batch-size must be positive\n\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+}
+
+// prepare recreates orders and outbox tables and topic of events
+func prepare(ctx context.Context, db ydb.Connection, prefix, topicPath string) {
+	log.Println("Drop tables and topic (if exists)...")
+	for _, name := range []string{"orders", "outbox"} {
+		_ = db.Table().Do(ctx,
+			func(ctx context.Context, s table.Session) error {
+				return s.DropTable(ctx, path.Join(prefix, name))
+			},
+			table.WithIdempotent(),
+		)
+	}
+	_ = db.Topic().Drop(ctx, topicPath)
+	_ = db.Topic().Drop(ctx, topicPath+"-dlq")
+
+	log.Println("Create tables and topic...")
+	err := db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) error {
+			return s.ExecuteSchemeQuery(ctx, fmt.Sprintf(`
+				PRAGMA TablePathPrefix("%s");
+
+				CREATE TABLE orders (
+					id Uint64,
+					amount Int64,
+					created_at Timestamp,
+					PRIMARY KEY (id)
+				);`, prefix,
+			))
+		},
+	)
+	if err != nil {
+		panic(fmt.Errorf("create orders table error: %w", err))
+	}
+	if err = createOutboxTable(ctx, db, prefix); err != nil {
+		panic(fmt.Errorf("create outbox table error: %w", err))
+	}
+	err = db.Topic().Create(ctx, topicPath,
+		topicoptions.CreateWithConsumer(topictypes.Consumer{Name: consumerName}),
+	)
+	if err != nil {
+		panic(fmt.Errorf("create topic error: %w", err))
+	}
+	err = db.Topic().Create(ctx, topicPath+"-dlq",
+		topicoptions.CreateWithConsumer(topictypes.Consumer{Name: "redrive"}),
+	)
+	if err != nil {
+		panic(fmt.Errorf("create dead-letter topic error: %w", err))
+	}
+}
+
+// orderCreated is an event payload published to topic
+type orderCreated struct {
+	OrderID   uint64    `json:"order_id"`
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// createOrders creates an order every orderInterval
+func createOrders(ctx context.Context, db ydb.Connection, prefix string) {
+	for id := uint64(1); ; id++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(orderInterval):
+		}
+		if err := createOrder(ctx, db, prefix, id, int64(id%10+1)*100); err != nil {
+			log.Printf("create order %d failed: %v", id, err)
+		}
+	}
+}
+
+// createOrder writes order and its event in one transaction, so event is published if and only if
+// the order is stored
+func createOrder(ctx context.Context, db ydb.Connection, prefix string, id uint64, amount int64) error {
+	return db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) error {
+			now := time.Now().UTC()
+			res, err := tx.Execute(ctx, fmt.Sprintf(`
+				PRAGMA TablePathPrefix("%s");
+
+				DECLARE $id AS Uint64;
+				DECLARE $amount AS Int64;
+				DECLARE $created_at AS Timestamp;
+
+				UPSERT INTO orders (id, amount, created_at) VALUES ($id, $amount, $created_at);`, prefix,
+			), table.NewQueryParameters(
+				table.ValueParam("$id", types.Uint64Value(id)),
+				table.ValueParam("$amount", types.Int64Value(amount)),
+				table.ValueParam("$created_at", types.TimestampValueFromTime(now)),
+			))
+			if err != nil {
+				return err
+			}
+			if err = res.Close(); err != nil {
+				return err
+			}
+			payload, err := json.Marshal(orderCreated{OrderID: id, Amount: amount, CreatedAt: now})
+			if err != nil {
+				return err
+			}
+			return enqueue(ctx, tx, prefix, payload)
+		},
+	)
+}
+
+// readEvents prints events published by relay, events which can't be decoded are published to dead-letter topic
+func readEvents(ctx context.Context, db ydb.Connection, topicPath string) {
+	reader, err := db.Topic().StartReader(consumerName, topicoptions.ReadTopic(topicPath))
+	if err != nil {
+		panic(fmt.Errorf("start reader error: %w", err))
+	}
+	defer func() { _ = reader.Close(context.Background()) }()
+
+	publisher, err := dlq.NewPublisher(db, topicPath+"-dlq", consumerName)
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = publisher.Close(context.Background()) }()
+
+	consumer := dlq.NewConsumer(reader, publisher, dlq.DefaultRetryPolicy,
+		func(ctx context.Context, msg *topicreader.Message, data []byte) error {
+			var event orderCreated
+			if err := json.Unmarshal(data, &event); err != nil {
+				return dlq.Permanent(err)
+			}
+			log.Printf("event #%d: order %d created with amount %d", msg.SeqNo, event.OrderID, event.Amount)
+			return nil
+		},
+	)
+	if err = consumer.Run(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("read events failed: %v", err)
+	}
+}
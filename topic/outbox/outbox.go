@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicwriter"
+)
+
+// createOutboxTable creates outbox table. Id of event is its sequence number in topic.
+func createOutboxTable(ctx context.Context, db ydb.Connection, prefix string) error {
+	return db.Table().Do(ctx,
+		func(ctx context.Context, s table.Session) error {
+			return s.ExecuteSchemeQuery(ctx, fmt.Sprintf(`
+				PRAGMA TablePathPrefix("%s");
+
+				CREATE TABLE outbox (
+					id Uint64,
+					payload String,
+					created_at Timestamp,
+					sent_at Timestamp,
+					PRIMARY KEY (id)
+				);`, prefix,
+			))
+		},
+	)
+}
+
+// enqueue inserts events into outbox in transaction tx, so events are stored only if the transaction is
+// committed. Events get consecutive ids after the last id in outbox. Outbox may be written only once in
+// transaction, because YDB transaction can't read table after writing it. Every transaction reads the tail of
+// outbox (ORDER BY id DESC LIMIT 1), so concurrent transactions which enqueue events conflict on it, and all
+// of them except one are aborted and retried.
+func enqueue(ctx context.Context, tx table.TransactionActor, prefix string, payloads ...[]byte) error {
+	values := make([]types.Value, len(payloads))
+	for i, p := range payloads {
+		values[i] = types.BytesValue(p)
+	}
+	res, err := tx.Execute(ctx, fmt.Sprintf(`
+		PRAGMA TablePathPrefix("%s");
+
+		DECLARE $payloads AS List<String>;
+
+		$last = (SELECT id FROM outbox ORDER BY id DESC LIMIT 1);
+
+		INSERT INTO outbox (id, payload, created_at)
+		SELECT
+			COALESCE($last, 0ul) + idx + 1ul AS id,
+			payload,
+			CurrentUtcTimestamp() AS created_at
+		FROM AS_TABLE(ListMap(ListEnumerate($payloads), ($p) -> (AsStruct($p.0 AS idx, $p.1 AS payload))));`,
+		prefix,
+	), table.NewQueryParameters(
+		table.ValueParam("$payloads", types.ListValue(values...)),
+	))
+	if err != nil {
+		return fmt.Errorf("enqueue to outbox failed: %w", err)
+	}
+	return res.Close()
+}
+
+// eventWriter publishes messages to topic, it is implemented by *topicwriter.Writer
+type eventWriter interface {
+	Write(ctx context.Context, messages ...topicwriter.Message) error
+	Close(ctx context.Context) error
+}
+
+// outboxTable reads unsent events of outbox and marks events as sent
+type outboxTable interface {
+	selectUnsent(ctx context.Context, cursor uint64, limit int) ([]outboxEvent, error)
+	markSent(ctx context.Context, first, last uint64) error
+}
+
+// relay publishes outbox events to topic in order of ids and marks them as sent. Id of event is used as
+// sequence number of message, so topic skips messages which were published before relay failed to mark them.
+type relay struct {
+	outbox    outboxTable
+	writer    eventWriter
+	batchSize int
+	// cursor is the last id which is published
+	cursor uint64
+}
+
+// newRelay starts topic writer with producerID. Only one relay with the same producerID may run at once.
+func newRelay(db ydb.Connection, prefix, topicPath, producerID string, batchSize int) (*relay, error) {
+	writer, err := db.Topic().StartWriter(producerID, topicPath,
+		topicoptions.WithMessageGroupID(producerID),
+		topicoptions.WithWriterSetAutoSeqNo(false),
+		topicoptions.WithSyncWrite(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("start writer failed: %w", err)
+	}
+	return &relay{
+		outbox:    &ydbOutbox{db: db, prefix: prefix},
+		writer:    writer,
+		batchSize: batchSize,
+	}, nil
+}
+
+// outboxEvent is a row of outbox table
+type outboxEvent struct {
+	id        uint64
+	payload   []byte
+	createdAt time.Time
+}
+
+// run relays events until ctx is done, outbox is polled every pollInterval while it has no unsent events
+func (r *relay) run(ctx context.Context, pollInterval time.Duration) error {
+	for {
+		n, err := r.relayBatch(ctx)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("relayed %d events, last id %d", n, r.cursor)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// relayBatch publishes the next batch of unsent events and marks them as sent
+func (r *relay) relayBatch(ctx context.Context) (int, error) {
+	events, err := r.outbox.selectUnsent(ctx, r.cursor, r.batchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	messages := make([]topicwriter.Message, len(events))
+	for i, e := range events {
+		messages[i] = topicwriter.Message{
+			SeqNo:     int64(e.id),
+			CreatedAt: e.createdAt,
+			Data:      bytes.NewReader(e.payload),
+		}
+	}
+	if err = r.writer.Write(ctx, messages...); err != nil {
+		return 0, fmt.Errorf("publish events failed: %w", err)
+	}
+	first, last := events[0].id, events[len(events)-1].id
+	if err = r.outbox.markSent(ctx, first, last); err != nil {
+		return 0, err
+	}
+	r.cursor = last
+	return len(events), nil
+}
+
+// ydbOutbox is an outbox table in YDB database
+type ydbOutbox struct {
+	db     ydb.Connection
+	prefix string
+}
+
+func (o *ydbOutbox) selectUnsent(ctx context.Context, cursor uint64, limit int) (events []outboxEvent, err error) {
+	err = o.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) error {
+			events = events[:0]
+			res, err := tx.Execute(ctx, fmt.Sprintf(`
+				PRAGMA TablePathPrefix("%s");
+
+				DECLARE $cursor AS Uint64;
+				DECLARE $limit AS Uint64;
+
+				SELECT id, payload, created_at
+				FROM outbox
+				WHERE id > $cursor AND sent_at IS NULL
+				ORDER BY id
+				LIMIT $limit;`, o.prefix,
+			), table.NewQueryParameters(
+				table.ValueParam("$cursor", types.Uint64Value(cursor)),
+				table.ValueParam("$limit", types.Uint64Value(uint64(limit))),
+			))
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = res.Close()
+			}()
+			for res.NextResultSet(ctx) {
+				for res.NextRow() {
+					var e outboxEvent
+					err = res.ScanNamed(
+						named.OptionalWithDefault("id", &e.id),
+						named.OptionalWithDefault("payload", &e.payload),
+						named.OptionalWithDefault("created_at", &e.createdAt),
+					)
+					if err != nil {
+						return err
+					}
+					events = append(events, e)
+				}
+			}
+			return res.Err()
+		},
+		table.WithIdempotent(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("select outbox events failed: %w", err)
+	}
+	return events, nil
+}
+
+func (o *ydbOutbox) markSent(ctx context.Context, first, last uint64) error {
+	err := o.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) error {
+			return markSent(ctx, tx, o.prefix, first, last)
+		},
+		table.WithIdempotent(),
+	)
+	if err != nil {
+		return fmt.Errorf("mark outbox events as sent failed: %w", err)
+	}
+	return nil
+}
+
+// markSent marks events from first to last as sent and removes previously sent events in transaction tx. The last
+// sent events are kept, so ids of new events continue sequence numbers which are already written to topic.
+func markSent(ctx context.Context, tx table.TransactionActor, prefix string, first, last uint64) error {
+	res, err := tx.Execute(ctx, fmt.Sprintf(`
+		PRAGMA TablePathPrefix("%s");
+
+		DECLARE $first AS Uint64;
+		DECLARE $last AS Uint64;
+
+		UPDATE outbox
+		SET sent_at = CurrentUtcTimestamp()
+		WHERE id >= $first AND id <= $last AND sent_at IS NULL;
+
+		DELETE FROM outbox
+		WHERE id < $first AND sent_at IS NOT NULL;`, prefix,
+	), table.NewQueryParameters(
+		table.ValueParam("$first", types.Uint64Value(first)),
+		table.ValueParam("$last", types.Uint64Value(last)),
+	))
+	if err != nil {
+		return err
+	}
+	return res.Close()
+}
+
+func (r *relay) Close(ctx context.Context) error {
+	return r.writer.Close(ctx)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicwriter"
+)
+
+// fakeTx records executed queries and their parameters
+type fakeTx struct {
+	queries []string
+	params  []map[string]string
+}
+
+type fakeResult struct {
+	result.Result
+}
+
+func (fakeResult) Close() error {
+	return nil
+}
+
+func (tx *fakeTx) ID() string {
+	return "fake"
+}
+
+func (tx *fakeTx) Execute(
+	_ context.Context, query string, params *table.QueryParameters, _ ...options.ExecuteDataQueryOption,
+) (result.Result, error) {
+	values := make(map[string]string)
+	params.Each(func(name string, v types.Value) {
+		values[name] = v.Yql()
+	})
+	tx.queries = append(tx.queries, query)
+	tx.params = append(tx.params, values)
+	return fakeResult{}, nil
+}
+
+func (tx *fakeTx) ExecuteStatement(
+	context.Context, table.Statement, *table.QueryParameters, ...options.ExecuteDataQueryOption,
+) (result.Result, error) {
+	return nil, errors.New("not implemented")
+}
+
+// checkQuery checks that the only query of tx contains all the parts and has expected parameters
+func checkQuery(t *testing.T, tx *fakeTx, parts []string, params map[string]string) {
+	t.Helper()
+	if len(tx.queries) != 1 {
+		t.Fatalf("executed %d queries, want 1", len(tx.queries))
+	}
+	for _, part := range parts {
+		if !strings.Contains(tx.queries[0], part) {
+			t.Fatalf("query doesn't contain '%s':\n%s", part, tx.queries[0])
+		}
+	}
+	if len(tx.params[0]) != len(params) {
+		t.Fatalf("unexpected parameters: %v", tx.params[0])
+	}
+	for name, v := range params {
+		if tx.params[0][name] != v {
+			t.Fatalf("parameter %s is %s, want %s", name, tx.params[0][name], v)
+		}
+	}
+}
+
+func TestEnqueueQuery(t *testing.T) {
+	tx := &fakeTx{}
+	if err := enqueue(context.Background(), tx, "/local", []byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	checkQuery(t, tx, []string{
+		`PRAGMA TablePathPrefix("/local");`,
+		`$last = (SELECT id FROM outbox ORDER BY id DESC LIMIT 1);`,
+		`COALESCE($last, 0ul) + idx + 1ul AS id`,
+	}, map[string]string{
+		"$payloads": `["a","b"]`,
+	})
+}
+
+func TestMarkSentQuery(t *testing.T) {
+	tx := &fakeTx{}
+	if err := markSent(context.Background(), tx, "/local", 3, 5); err != nil {
+		t.Fatal(err)
+	}
+	checkQuery(t, tx, []string{
+		`PRAGMA TablePathPrefix("/local");`,
+		`WHERE id >= $first AND id <= $last AND sent_at IS NULL;`,
+		`WHERE id < $first AND sent_at IS NOT NULL;`,
+	}, map[string]string{
+		"$first": "3ul",
+		"$last":  "5ul",
+	})
+}
+
+// fakeOutbox is an outbox in memory, events are sorted by id
+type fakeOutbox struct {
+	events  []outboxEvent
+	sent    map[uint64]bool
+	markErr error
+}
+
+func newFakeOutbox(payloads ...string) *fakeOutbox {
+	o := &fakeOutbox{sent: make(map[uint64]bool)}
+	for i, p := range payloads {
+		o.events = append(o.events, outboxEvent{id: uint64(i + 1), payload: []byte(p)})
+	}
+	return o
+}
+
+func (o *fakeOutbox) selectUnsent(_ context.Context, cursor uint64, limit int) (events []outboxEvent, _ error) {
+	for _, e := range o.events {
+		if e.id > cursor && !o.sent[e.id] && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (o *fakeOutbox) markSent(_ context.Context, first, last uint64) error {
+	if o.markErr != nil {
+		return o.markErr
+	}
+	for id := first; id <= last; id++ {
+		o.sent[id] = true
+	}
+	return nil
+}
+
+// fakeWriter records sequence numbers and payloads of written messages, it fails writing with err
+type fakeWriter struct {
+	seqNos   []int64
+	payloads []string
+	err      error
+}
+
+func (w *fakeWriter) Write(_ context.Context, messages ...topicwriter.Message) error {
+	if w.err != nil {
+		return w.err
+	}
+	for _, msg := range messages {
+		data, err := io.ReadAll(msg.Data)
+		if err != nil {
+			return err
+		}
+		w.seqNos = append(w.seqNos, msg.SeqNo)
+		w.payloads = append(w.payloads, string(data))
+	}
+	return nil
+}
+
+func (w *fakeWriter) Close(context.Context) error {
+	return nil
+}
+
+func TestRelayBatch(t *testing.T) {
+	outbox, writer := newFakeOutbox("a", "b", "c", "d", "e"), &fakeWriter{}
+	r := &relay{outbox: outbox, writer: writer, batchSize: 2}
+	for _, expected := range []struct {
+		count  int
+		cursor uint64
+	}{
+		{count: 2, cursor: 2},
+		{count: 2, cursor: 4},
+		{count: 1, cursor: 5},
+		{count: 0, cursor: 5},
+	} {
+		n, err := r.relayBatch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expected.count || r.cursor != expected.cursor {
+			t.Fatalf("relayed %d events with cursor %d, want %d with cursor %d",
+				n, r.cursor, expected.count, expected.cursor,
+			)
+		}
+	}
+	if strings.Join(writer.payloads, "") != "abcde" || len(outbox.sent) != 5 {
+		t.Fatalf("events are relayed out of order: %v", writer.payloads)
+	}
+	for i, seqNo := range writer.seqNos {
+		if seqNo != int64(i+1) {
+			t.Fatalf("sequence number of message %d is %d", i, seqNo)
+		}
+	}
+}
+
+func TestRelayBatchFailed(t *testing.T) {
+	outbox, writer := newFakeOutbox("a", "b", "c"), &fakeWriter{err: errors.New("topic is unavailable")}
+	r := &relay{outbox: outbox, writer: writer, batchSize: 2}
+	if _, err := r.relayBatch(context.Background()); !errors.Is(err, writer.err) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.cursor != 0 || len(outbox.sent) != 0 {
+		t.Fatalf("not published events are marked, cursor is %d", r.cursor)
+	}
+
+	// events are published, but relay fails to mark them as sent
+	writer.err, outbox.markErr = nil, errors.New("table is unavailable")
+	if _, err := r.relayBatch(context.Background()); !errors.Is(err, outbox.markErr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r.cursor != 0 {
+		t.Fatalf("cursor is moved to %d after failed marking", r.cursor)
+	}
+
+	// the same events are published again with the same sequence numbers, so topic skips them
+	outbox.markErr = nil
+	if n, err := r.relayBatch(context.Background()); err != nil || n != 2 || r.cursor != 2 {
+		t.Fatalf("relayed %d events with cursor %d: %v", n, r.cursor, err)
+	}
+	expected := []int64{1, 2, 1, 2}
+	if len(writer.seqNos) != len(expected) {
+		t.Fatalf("unexpected sequence numbers: %v", writer.seqNos)
+	}
+	for i := range expected {
+		if writer.seqNos[i] != expected[i] {
+			t.Fatalf("unexpected sequence numbers: %v", writer.seqNos)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package topicreaderexamples
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
+	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
+)
+
+var (
+	// ErrLeaseLost is returned when partition is not locked by owner of storage or its lease is expired
+	ErrLeaseLost = errors.New("partition lease is lost")
+
+	// ErrBatchAlreadyProcessed is returned when batch starts before committed offset of partition
+	ErrBatchAlreadyProcessed = errors.New("batch is already processed")
+)
+
+// OffsetStorage stores read progress of consumer in YDB table keyed by consumer, topic and partition.
+// Offset is committed in the same transaction as result of batch processing, so every message is processed
+// exactly once. Partition is processed only by owner of the lease on it, lease is extended by commits and
+// by background renewal and expires if owner has gone. Lease expiration is set and checked by server time
+// inside queries, so clocks of reader instances don't affect leases.
+type OffsetStorage struct {
+	db        ydb.Connection
+	tablePath string
+	consumer  string
+	owner     string
+	leaseTTL  time.Duration
+}
+
+// NewOffsetStorage creates storage of consumer offsets in table tablePath, owner identifies reader instance
+func NewOffsetStorage(db ydb.Connection, tablePath, consumer, owner string, leaseTTL time.Duration) *OffsetStorage {
+	return &OffsetStorage{
+		db:        db,
+		tablePath: tablePath,
+		consumer:  consumer,
+		owner:     owner,
+		leaseTTL:  leaseTTL,
+	}
+}
+
+// CreateTable creates table of offsets
+func (s *OffsetStorage) CreateTable(ctx context.Context) error {
+	return s.db.Table().Do(ctx,
+		func(ctx context.Context, session table.Session) error {
+			return session.ExecuteSchemeQuery(ctx, fmt.Sprintf(`
+				CREATE TABLE IF NOT EXISTS `+"`%s`"+` (
+					consumer Utf8,
+					topic Utf8,
+					partition_id Int64,
+					committed_offset Int64,
+					owner Utf8,
+					lease_expires_at Timestamp,
+					PRIMARY KEY (consumer, topic, partition_id)
+				);`, s.tablePath,
+			))
+		},
+		table.WithIdempotent(),
+	)
+}
+
+// partitionState is a row of offsets table, leaseActive reports whether lease is not expired by server time
+type partitionState struct {
+	offset      *int64
+	owner       string
+	leaseActive bool
+}
+
+func (s *OffsetStorage) keyParams(topic string, partition int64, opts ...table.ParameterOption) *table.QueryParameters {
+	return table.NewQueryParameters(append([]table.ParameterOption{
+		table.ValueParam("$consumer", types.UTF8Value(s.consumer)),
+		table.ValueParam("$topic", types.UTF8Value(topic)),
+		table.ValueParam("$partition_id", types.Int64Value(partition)),
+	}, opts...)...)
+}
+
+func (s *OffsetStorage) selectState(
+	ctx context.Context, tx table.TransactionActor, topic string, partition int64,
+) (state partitionState, err error) {
+	res, err := tx.Execute(ctx, fmt.Sprintf(`
+		DECLARE $consumer AS Utf8;
+		DECLARE $topic AS Utf8;
+		DECLARE $partition_id AS Int64;
+
+		SELECT
+			committed_offset,
+			owner,
+			COALESCE(lease_expires_at > CurrentUtcTimestamp(), false) AS lease_active
+		FROM `+"`%s`"+`
+		WHERE consumer = $consumer AND topic = $topic AND partition_id = $partition_id;`, s.tablePath,
+	), s.keyParams(topic, partition))
+	if err != nil {
+		return state, err
+	}
+	defer func() {
+		_ = res.Close()
+	}()
+	for res.NextResultSet(ctx) {
+		for res.NextRow() {
+			err = res.ScanNamed(
+				named.Optional("committed_offset", &state.offset),
+				named.OptionalWithDefault("owner", &state.owner),
+				named.OptionalWithDefault("lease_active", &state.leaseActive),
+			)
+			if err != nil {
+				return state, err
+			}
+		}
+	}
+	return state, res.Err()
+}
+
+// holds reports whether partition is locked by owner of storage
+func (s *OffsetStorage) holds(state partitionState) bool {
+	return state.owner == s.owner && state.leaseActive
+}
+
+// canLock reports whether partition may be locked by owner of storage: it is not locked, is locked by the same
+// owner or lease of another owner is expired
+func (s *OffsetStorage) canLock(state partitionState) bool {
+	return state.owner == "" || state.owner == s.owner || !state.leaseActive
+}
+
+// checkCommit returns error if batch which starts from offset can't be committed to partition in state
+func (s *OffsetStorage) checkCommit(state partitionState, topic string, partition, offset int64) error {
+	if !s.holds(state) {
+		return fmt.Errorf("commit to partition %d of %s failed: %w", partition, topic, ErrLeaseLost)
+	}
+	if state.offset != nil && offset < *state.offset {
+		return fmt.Errorf("commit offset %d to partition %d of %s failed: %w",
+			offset, partition, topic, ErrBatchAlreadyProcessed,
+		)
+	}
+	return nil
+}
+
+// upsertLease sets owner and lease expiration of partition, committed offset is kept
+func (s *OffsetStorage) upsertLease(
+	ctx context.Context, tx table.TransactionActor, topic string, partition int64, owner *string,
+) error {
+	ownerValue, ttlValue := types.NullValue(types.TypeUTF8), types.NullValue(types.TypeInterval)
+	if owner != nil {
+		ownerValue = types.OptionalValue(types.UTF8Value(*owner))
+		ttlValue = types.OptionalValue(types.IntervalValueFromDuration(s.leaseTTL))
+	}
+	res, err := tx.Execute(ctx, fmt.Sprintf(`
+		DECLARE $consumer AS Utf8;
+		DECLARE $topic AS Utf8;
+		DECLARE $partition_id AS Int64;
+		DECLARE $owner AS Optional<Utf8>;
+		DECLARE $lease_ttl AS Optional<Interval>;
+
+		UPSERT INTO `+"`%s`"+` (consumer, topic, partition_id, owner, lease_expires_at)
+		VALUES ($consumer, $topic, $partition_id, $owner, CurrentUtcTimestamp() + $lease_ttl);`, s.tablePath,
+	), s.keyParams(topic, partition,
+		table.ValueParam("$owner", ownerValue),
+		table.ValueParam("$lease_ttl", ttlValue),
+	))
+	if err != nil {
+		return err
+	}
+	return res.Close()
+}
+
+// tryLock acquires or extends lease on partition, it returns false if partition is locked by another owner
+func (s *OffsetStorage) tryLock(ctx context.Context, topic string, partition int64) (locked bool, err error) {
+	err = s.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) error {
+			state, err := s.selectState(ctx, tx, topic, partition)
+			if err != nil {
+				return err
+			}
+			locked = s.canLock(state)
+			if !locked {
+				return nil
+			}
+			return s.upsertLease(ctx, tx, topic, partition, &s.owner)
+		},
+		table.WithIdempotent(),
+	)
+	return locked, err
+}
+
+// Lock acquires lease on partition, it waits until lease of another owner is released or expired
+func (s *OffsetStorage) Lock(ctx context.Context, topic string, partition int64) error {
+	for {
+		locked, err := s.tryLock(ctx, topic, partition)
+		if err != nil {
+			return fmt.Errorf("lock partition %d of %s failed: %w", partition, topic, err)
+		}
+		if locked {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.leaseTTL / 10):
+		}
+	}
+}
+
+// KeepLease extends lease on partition until ctx is done, ctx is usually a context of partition session
+func (s *OffsetStorage) KeepLease(ctx context.Context, topic string, partition int64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.leaseTTL / 3):
+		}
+		err := s.db.Table().DoTx(ctx,
+			func(ctx context.Context, tx table.TransactionActor) error {
+				state, err := s.selectState(ctx, tx, topic, partition)
+				if err != nil {
+					return err
+				}
+				if !s.holds(state) {
+					return ErrLeaseLost
+				}
+				return s.upsertLease(ctx, tx, topic, partition, &s.owner)
+			},
+			table.WithIdempotent(),
+		)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("extend lease on partition %d of %s failed: %v", partition, topic, err)
+			if errors.Is(err, ErrLeaseLost) {
+				return
+			}
+		}
+	}
+}
+
+// Unlock releases lease on partition if it is held by owner of storage
+func (s *OffsetStorage) Unlock(ctx context.Context, topic string, partition int64) error {
+	err := s.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) error {
+			state, err := s.selectState(ctx, tx, topic, partition)
+			if err != nil || state.owner != s.owner {
+				return err
+			}
+			return s.upsertLease(ctx, tx, topic, partition, nil)
+		},
+		table.WithIdempotent(),
+	)
+	if err != nil {
+		return fmt.Errorf("unlock partition %d of %s failed: %w", partition, topic, err)
+	}
+	return nil
+}
+
+// ReadOffset returns committed offset of partition, ok is false if partition has no committed offset
+func (s *OffsetStorage) ReadOffset(ctx context.Context, topic string, partition int64) (offset int64, ok bool, err error) {
+	err = s.db.Table().DoTx(ctx,
+		func(ctx context.Context, tx table.TransactionActor) error {
+			state, err := s.selectState(ctx, tx, topic, partition)
+			if err != nil {
+				return err
+			}
+			if state.offset != nil {
+				offset, ok = *state.offset, true
+			}
+			return nil
+		},
+		table.WithIdempotent(),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("read offset of partition %d of %s failed: %w", partition, topic, err)
+	}
+	return offset, ok, nil
+}
+
+// GetPartitionStartOffset locks partition and returns its committed offset, it is used with
+// topicoptions.WithGetPartitionStartOffset. Lease is kept while partition session is alive.
+// If previous owner of partition has crashed without unlock, it blocks reading until lease of that owner
+// expires, that is up to leaseTTL.
+func (s *OffsetStorage) GetPartitionStartOffset(
+	ctx context.Context,
+	req topicoptions.GetPartitionStartOffsetRequest,
+) (
+	res topicoptions.GetPartitionStartOffsetResponse,
+	err error,
+) {
+	if err = s.Lock(ctx, req.Topic, req.PartitionID); err != nil {
+		return res, err
+	}
+	go s.KeepLease(ctx, req.Topic, req.PartitionID)
+
+	offset, ok, err := s.ReadOffset(ctx, req.Topic, req.PartitionID)
+	if ok {
+		res.StartFrom(offset)
+	}
+	return res, err
+}
+
+// CommitTx commits offset after batch in transaction tx, which also writes result of batch processing.
+// Transaction fails if lease on partition is lost or batch is already processed, so result of processing
+// is not written twice.
+func (s *OffsetStorage) CommitTx(ctx context.Context, tx table.TransactionActor, batch *topicreader.Batch) error {
+	if len(batch.Messages) == 0 {
+		return nil
+	}
+	topic, partition := batch.Topic(), batch.PartitionID()
+	state, err := s.selectState(ctx, tx, topic, partition)
+	if err != nil {
+		return err
+	}
+	if err = s.checkCommit(state, topic, partition, batch.Messages[0].Offset); err != nil {
+		return err
+	}
+	res, err := tx.Execute(ctx, fmt.Sprintf(`
+		DECLARE $consumer AS Utf8;
+		DECLARE $topic AS Utf8;
+		DECLARE $partition_id AS Int64;
+		DECLARE $committed_offset AS Int64;
+		DECLARE $lease_ttl AS Interval;
+
+		UPSERT INTO `+"`%s`"+` (consumer, topic, partition_id, committed_offset, lease_expires_at)
+		VALUES ($consumer, $topic, $partition_id, $committed_offset, CurrentUtcTimestamp() + $lease_ttl);`, s.tablePath,
+	), s.keyParams(topic, partition,
+		table.ValueParam("$committed_offset", types.Int64Value(getEndOffset(batch))),
+		table.ValueParam("$lease_ttl", types.IntervalValueFromDuration(s.leaseTTL)),
+	))
+	if err != nil {
+		return err
+	}
+	return res.Close()
+}
@@ -0,0 +1,84 @@
+package topicreaderexamples
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func testStorage(owner string) *OffsetStorage {
+	return NewOffsetStorage(nil, "/local/topic_offsets", "consumer", owner, time.Minute)
+}
+
+func TestCanLock(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		state  partitionState
+		locked bool
+	}{
+		{name: "new or released partition", state: partitionState{}, locked: true},
+		{name: "own lease", state: partitionState{owner: "a", leaseActive: true}, locked: true},
+		{name: "own expired lease", state: partitionState{owner: "a"}, locked: true},
+		{name: "lease of another", state: partitionState{owner: "b", leaseActive: true}},
+		{name: "takeover after expiration", state: partitionState{owner: "b"}, locked: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if locked := testStorage("a").canLock(tt.state); locked != tt.locked {
+				t.Fatalf("locked is %v, want %v", locked, tt.locked)
+			}
+		})
+	}
+}
+
+func TestLeaseExpiration(t *testing.T) {
+	a, b := testStorage("a"), testStorage("b")
+	state := partitionState{owner: "a", leaseActive: true}
+	if !a.holds(state) || b.holds(state) || b.canLock(state) {
+		t.Fatal("lease is not held by its owner")
+	}
+
+	// owner has gone and server time passed its lease expiration
+	state.leaseActive = false
+	if a.holds(state) {
+		t.Fatal("expired lease is held")
+	}
+	if !b.canLock(state) {
+		t.Fatal("expired lease is not taken over")
+	}
+}
+
+func TestCheckCommit(t *testing.T) {
+	committed := int64(10)
+	held := partitionState{offset: &committed, owner: "a", leaseActive: true}
+	for _, tt := range []struct {
+		name   string
+		state  partitionState
+		offset int64
+		err    error
+	}{
+		{name: "first batch", state: partitionState{owner: "a", leaseActive: true}, offset: 0},
+		{name: "next batch", state: held, offset: 10},
+		{name: "batch after gap", state: held, offset: 12},
+		{name: "processed batch", state: held, offset: 5, err: ErrBatchAlreadyProcessed},
+		{
+			name:   "lease of another",
+			state:  partitionState{offset: &committed, owner: "b", leaseActive: true},
+			offset: 10,
+			err:    ErrLeaseLost,
+		},
+		{
+			name:   "expired lease",
+			state:  partitionState{offset: &committed, owner: "a"},
+			offset: 10,
+			err:    ErrLeaseLost,
+		},
+		{name: "released lease", state: partitionState{offset: &committed}, offset: 10, err: ErrLeaseLost},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testStorage("a").checkCommit(tt.state, "topic", 1, tt.offset)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
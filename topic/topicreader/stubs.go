@@ -3,23 +3,13 @@ package topicreaderexamples
 import (
 	"context"
 
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
 )
 
-func getEndOffset(b *topicreader.Batch) int64 { //nolint:unused
-	panic("example stub")
-}
-
-func externalSystemCommit(ctx context.Context, topic string, partition int64, offset int64) error { //nolint:unused
-	panic("example stub")
-}
-
-func externalSystemLock(ctx context.Context, topic string, partition int64) (err error) {
-	panic("example stub")
-}
-
-func externalSystemUnlock(ctx context.Context, topic string, partition int64) error {
-	panic("example stub")
+// getEndOffset returns offset of the next message after batch
+func getEndOffset(b *topicreader.Batch) int64 {
+	return b.Messages[len(b.Messages)-1].Offset + 1
 }
 
 func processBatch(ctx context.Context, batch *topicreader.Batch) {
@@ -27,11 +17,12 @@ func processBatch(ctx context.Context, batch *topicreader.Batch) {
 	panic("example stub")
 }
 
-func processMessage(ctx context.Context, m *topicreader.Message) {
-	// recommend derive ctx from m.Context() for handle signal about stop message processing
+func processBatchTx(ctx context.Context, tx table.TransactionActor, batch *topicreader.Batch) error {
+	// writes result of batch processing in transaction tx
 	panic("example stub")
 }
 
-func readLastOffsetFromDB(ctx context.Context, topic string, partition int64) (int64, error) {
+func processMessage(ctx context.Context, m *topicreader.Message) {
+	// recommend derive ctx from m.Context() for handle signal about stop message processing
 	panic("example stub")
 }
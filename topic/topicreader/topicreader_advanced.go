@@ -4,8 +4,11 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"path"
+	"time"
 
 	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicreader"
 )
@@ -64,35 +67,26 @@ func ProcessMessagesWithSyncCommit(ctx context.Context, db ydb.Connection) {
 	}
 }
 
-// OwnReadProgressStorage example about store reading progress in external system and don't use
-// commit messages to YDB
+// OwnReadProgressStorage example about store reading progress in YDB table in the same transaction as result of
+// processing and don't use commit messages to YDB topic
 func OwnReadProgressStorage(ctx context.Context, db ydb.Connection) {
-	reader, _ := db.Topic().StartReader("consumer", topicoptions.ReadTopic("asd"),
-		topicoptions.WithGetPartitionStartOffset(
-			func(
-				ctx context.Context,
-				req topicoptions.GetPartitionStartOffsetRequest,
-			) (
-				res topicoptions.GetPartitionStartOffsetResponse,
-				err error,
-			) {
-				offset, err := readLastOffsetFromDB(ctx, req.Topic, req.PartitionID)
-				res.StartFrom(offset)
+	storage := NewOffsetStorage(db, path.Join(db.Name(), "topic_offsets"), "consumer", "instance-1", time.Minute)
+	_ = storage.CreateTable(ctx)
 
-				// Reader will stop if return err != nil
-				return res, err
-			}),
+	reader, _ := db.Topic().StartReader("consumer", topicoptions.ReadTopic("asd"),
+		// Reader will stop if storage returns err != nil. Partition which owner has crashed is not read
+		// until lease of the owner expires (up to a minute here)
+		topicoptions.WithGetPartitionStartOffset(storage.GetPartitionStartOffset),
 	)
 
 	for {
 		batch, _ := reader.ReadMessageBatch(ctx)
 
-		processBatch(batch.Context(), batch)
-		_ = externalSystemCommit(
-			batch.Context(),
-			batch.Topic(),
-			batch.PartitionID(),
-			getEndOffset(batch),
-		)
+		_ = db.Table().DoTx(batch.Context(), func(ctx context.Context, tx table.TransactionActor) error {
+			if err := processBatchTx(ctx, tx, batch); err != nil {
+				return err
+			}
+			return storage.CommitTx(ctx, tx, batch)
+		})
 	}
 }
@@ -2,9 +2,13 @@ package topicreaderexamples
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"time"
 
 	"github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
 	"github.com/ydb-platform/ydb-go-sdk/v3/topic/topicoptions"
 	"github.com/ydb-platform/ydb-go-sdk/v3/trace"
 )
@@ -32,6 +36,9 @@ func ExplicitPartitionStartStopHandler(ctx context.Context, db ydb.Connection) {
 	readContext, stopReader := context.WithCancel(context.Background())
 	defer stopReader()
 
+	storage := NewOffsetStorage(db, path.Join(db.Name(), "topic_offsets"), "consumer", "instance-1", time.Minute)
+	_ = storage.CreateTable(ctx)
+
 	reader, _ := db.Topic().StartReader("consumer", topicoptions.ReadTopic("asd"),
 		topicoptions.WithReaderTrace(
 			trace.Topic{
@@ -40,10 +47,12 @@ func ExplicitPartitionStartStopHandler(ctx context.Context, db ydb.Connection) {
 				) func(
 					trace.TopicReaderPartitionReadStartResponseDoneInfo,
 				) {
-					err := externalSystemLock(info.PartitionContext, info.Topic, info.PartitionID)
+					err := storage.Lock(info.PartitionContext, info.Topic, info.PartitionID)
 					if err != nil {
 						stopReader()
+						return nil
 					}
+					go storage.KeepLease(info.PartitionContext, info.Topic, info.PartitionID)
 					return nil
 				},
 				OnReaderPartitionReadStopResponse: func(
@@ -52,7 +61,7 @@ func ExplicitPartitionStartStopHandler(ctx context.Context, db ydb.Connection) {
 					trace.TopicReaderPartitionReadStopResponseDoneInfo,
 				) {
 					if info.Graceful {
-						err := externalSystemUnlock(ctx, info.Topic, info.PartitionID)
+						err := storage.Unlock(ctx, info.Topic, info.PartitionID)
 						if err != nil {
 							stopReader()
 						}
@@ -71,44 +80,23 @@ func ExplicitPartitionStartStopHandler(ctx context.Context, db ydb.Connection) {
 	for {
 		batch, _ := reader.ReadMessageBatch(readContext)
 
-		processBatch(batch.Context(), batch)
-		_ = externalSystemCommit(
-			batch.Context(),
-			batch.Topic(),
-			batch.PartitionID(),
-			getEndOffset(batch),
-		)
+		_ = db.Table().DoTx(batch.Context(), func(ctx context.Context, tx table.TransactionActor) error {
+			if err := processBatchTx(ctx, tx, batch); err != nil {
+				return err
+			}
+			return storage.CommitTx(ctx, tx, batch)
+		})
 	}
 }
 
 // PartitionStartStopHandlerAndOwnReadProgressStorage example of complex use explicit start/stop partition handler
-// and own progress storage in external system
+// and own progress storage in YDB table
 func PartitionStartStopHandlerAndOwnReadProgressStorage(ctx context.Context, db ydb.Connection) {
 	readContext, stopReader := context.WithCancel(context.Background())
 	defer stopReader()
 
-	readStartPosition := func(
-		ctx context.Context,
-		req topicoptions.GetPartitionStartOffsetRequest,
-	) (res topicoptions.GetPartitionStartOffsetResponse, err error) {
-		offset, err := readLastOffsetFromDB(ctx, req.Topic, req.PartitionID)
-		res.StartFrom(offset)
-
-		// Reader will stop if return err != nil
-		return res, err
-	}
-
-	onPartitionStart := func(
-		info trace.TopicReaderPartitionReadStartResponseStartInfo,
-	) func(
-		trace.TopicReaderPartitionReadStartResponseDoneInfo,
-	) {
-		err := externalSystemLock(info.PartitionContext, info.Topic, info.PartitionID)
-		if err != nil {
-			stopReader()
-		}
-		return nil
-	}
+	storage := NewOffsetStorage(db, path.Join(db.Name(), "topic_offsets"), "consumer", "instance-1", time.Minute)
+	_ = storage.CreateTable(ctx)
 
 	onPartitionStop := func(
 		info trace.TopicReaderPartitionReadStopResponseStartInfo,
@@ -116,7 +104,7 @@ func PartitionStartStopHandlerAndOwnReadProgressStorage(ctx context.Context, db
 		trace.TopicReaderPartitionReadStopResponseDoneInfo,
 	) {
 		if info.Graceful {
-			err := externalSystemUnlock(ctx, info.Topic, info.PartitionID)
+			err := storage.Unlock(ctx, info.Topic, info.PartitionID)
 			if err != nil {
 				stopReader()
 			}
@@ -125,12 +113,11 @@ func PartitionStartStopHandlerAndOwnReadProgressStorage(ctx context.Context, db
 	}
 
 	r, _ := db.Topic().StartReader("consumer", topicoptions.ReadTopic("asd"),
-
-		topicoptions.WithGetPartitionStartOffset(readStartPosition),
+		// storage locks partition and reads its start offset, reader will stop if it returns err != nil
+		topicoptions.WithGetPartitionStartOffset(storage.GetPartitionStartOffset),
 		topicoptions.WithReaderTrace(
 			trace.Topic{
-				OnReaderPartitionReadStartResponse: onPartitionStart,
-				OnReaderPartitionReadStopResponse:  onPartitionStop,
+				OnReaderPartitionReadStopResponse: onPartitionStop,
 			},
 		),
 	)
@@ -142,7 +129,15 @@ func PartitionStartStopHandlerAndOwnReadProgressStorage(ctx context.Context, db
 	for {
 		batch, _ := r.ReadMessageBatch(readContext)
 
-		processBatch(batch.Context(), batch)
-		_ = externalSystemCommit(batch.Context(), batch.Topic(), batch.PartitionID(), getEndOffset(batch))
+		err := db.Table().DoTx(batch.Context(), func(ctx context.Context, tx table.TransactionActor) error {
+			if err := processBatchTx(ctx, tx, batch); err != nil {
+				return err
+			}
+			return storage.CommitTx(ctx, tx, batch)
+		})
+		if errors.Is(err, ErrLeaseLost) {
+			// partition is processed by another reader now
+			stopReader()
+		}
 	}
 }